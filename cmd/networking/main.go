@@ -8,6 +8,7 @@ import (
 	networking "github.com/bukukasio/krm-functions/pkg/networking"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework/command"
+	"sigs.k8s.io/kustomize/kyaml/kio"
 )
 
 func main() {
@@ -23,28 +24,27 @@ func main() {
 }
 
 func Process(resourceList *framework.ResourceList) error {
-	fnConfig := resourceList.FunctionConfig
-
-	if fnConfig == nil {
+	if resourceList.FunctionConfig == nil {
 		return errors.New("no function config specified")
 	}
-	injector, err := networking.FnConfigFromRNode(fnConfig)
-	if err != nil {
-		return err
+
+	config := networking.FunctionConfig{}
+	p := framework.SimpleProcessor{
+		Filter: kio.FilterFunc(config.Filter),
+		Config: &config,
 	}
-	items, err := injector.Filter(resourceList.Items)
-	if err != nil {
-		resourceList.Results = framework.Results{
-			&framework.Result{
-				Message:  err.Error(),
-				Severity: framework.Error,
-			},
-		}
+	if err := p.Process(resourceList); err != nil {
+		resourceList.Results = append(resourceList.Results, &framework.Result{
+			Message:  err.Error(),
+			Severity: framework.Error,
+		})
+	}
+	// results returned by the filter do not fail the processor, so errors among them have to
+	if resourceList.Results.ExitCode() != 0 {
 		return resourceList.Results
 	}
-	resourceList.Items = items
 
-	results, err := injector.Results()
+	results, err := config.Results()
 	if err != nil {
 		resourceList.Results = framework.Results{
 			&framework.Result{
@@ -54,7 +54,7 @@ func Process(resourceList *framework.ResourceList) error {
 		}
 		return resourceList.Results
 	}
-	resourceList.Results = results
+	resourceList.Results = append(resourceList.Results, results...)
 
 	return nil
 }
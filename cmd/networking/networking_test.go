@@ -1,13 +1,16 @@
 package main
 
 import (
-	"io/ioutil"
+	"bytes"
 	"os"
 	"testing"
 
-	networking "github.com/bukukasio/krm-functions/pkg/networking"
+	workloads "github.com/bukukasio/krm-functions/pkg/workloads"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
 	"sigs.k8s.io/kustomize/kyaml/kio"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 type test struct {
@@ -16,13 +19,59 @@ type test struct {
 	expected    string
 	resultCount int
 	errorMsg    string
+	// results is expected in the results as they print, blank line separated
+	results string
+}
+
+// TestMain runs the tests from the repository root, the function reads the CRD make crd
+// generates from the working directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestMissingSchema(t *testing.T) {
+	wd, err := os.Getwd()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.NoError(t, os.Chdir(t.TempDir())) {
+		t.FailNow()
+	}
+	defer os.Chdir(wd)
+
+	reader := &kio.ByteReader{
+		Reader: bytes.NewBufferString(`
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp`),
+		OmitReaderAnnotations: true,
+	}
+	items, err := reader.Read()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	err = Process(&framework.ResourceList{Items: items, FunctionConfig: reader.FunctionConfig})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "reading crd file")
+	}
 }
 
 func TestInjectRoutes(t *testing.T) {
 	var tests = []test{
 		{
-			name:        "route injection",
+			name:        "route injection without a workload",
 			resultCount: 1,
+			errorMsg:    "could not find a Deployment, StatefulSet or Rollout with label app=testapp",
 			input: `
 apiVersion: config.kubernetes.io/v1
 kind: ResourceList
@@ -102,70 +151,4063 @@ functionConfig:
   kind: SetRoutes
   metadata:
     name: setroutes-fn-config
-  data:
+  spec:
     app: testapp
     hosts:
     - domain1.test.com
     - domain2.test.com
     routes:
-      - match: Path('/test1')
-        kind: Rule`,
+      - match: Path('/test1')`,
 		},
+		{
+			name:        "routes to a rollout",
+			resultCount: 3,
+			expected: `    services:
+    - name: testapp
+      port: 80`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: argoproj.io/v1alpha1
+  kind: Rollout
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      metadata:
+        labels:
+          app: testapp
+      spec:
+        containers:
+        - name: testapp
+          image: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "routes to a statefulset",
+			resultCount: 3,
+			expected:    "targetPort: 9000",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: StatefulSet
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      metadata:
+        labels:
+          app: testapp
+      spec:
+        containers:
+        - name: testapp
+          image: testapp
+          ports:
+          - name: https
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "picks the app workload and container",
+			resultCount: 3,
+			expected:    "targetPort: 8000",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp-worker
+    labels:
+      app: testapp-worker
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp-worker
+          ports:
+          - name: https
+            containerPort: 7000
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: cloudsql-proxy
+          ports:
+          - name: https
+            containerPort: 5432
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp-pgbouncer
+    labels:
+      app: testapp-pgbouncer
+  spec:
+    template:
+      spec:
+        containers:
+        - name: pgbouncer
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "several workloads with the app label",
+			resultCount: 2,
+			errorMsg:    "2 workloads have label app=testapp",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+- apiVersion: argoproj.io/v1alpha1
+  kind: Rollout
+  metadata:
+    name: testapp-canary
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "no container named after the app",
+			resultCount: 1,
+			errorMsg:    "Deployment testapp has no container named testapp",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: server
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "replaces only owned resources",
+			resultCount: 3,
+			expected: `  name: echo-server
+  annotations:
+    app.tokko.io/owner: team-a`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: echo-server
+    annotations:
+      app.tokko.io/owner: team-a
+  spec:
+    ports:
+    - port: 80
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: testapp-http
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    routes:
+    - match: Path(` + "`/stale`" + `)
+      kind: Rule
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: testapp
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    ports:
+    - port: 80
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "conflicts with a resource it does not own",
+			resultCount: 1,
+			errorMsg:    "Certificate testapp already exists and is not generated by LummoNetworking/testapp-networking",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: cert-manager.io/v1
+  kind: Certificate
+  metadata:
+    name: testapp
+  spec:
+    secretName: testapp-cert
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "adopts the Service workloads generated",
+			resultCount: 3,
+			results:     "[info] v1/Service/testapp spec.app: updated Service testapp",
+			expected: `
+apiVersion: v1
+kind: Service
+metadata:
+  creationTimestamp: null
+  name: testapp
+  labels:
+    app: testapp
+    part-of: foobar
+  annotations:
+    app.tokko.io/generated-by: LummoNetworking/testapp-networking
+spec:
+  ports:
+  - name: https
+    port: 8000
+    targetPort: 8000
+  selector:
+    app: testapp
+    part-of: foobar
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+      part-of: foobar
+  spec:
+    template:
+      metadata:
+        labels:
+          app: testapp
+          part-of: foobar
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+      part-of: foobar
+    annotations:
+      app.tokko.io/generated-by: LummoDeployment/testapp
+  spec:
+    ports:
+    - name: https
+      port: 8000
+      targetPort: 8000
+    selector:
+      app: testapp
+      part-of: foobar
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "conflicts with a Service no generator marked",
+			resultCount: 1,
+			errorMsg:    "Service testapp already exists and is not generated by LummoNetworking/testapp-networking",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: testapp
+  spec:
+    ports:
+    - name: https
+      port: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "namespaced config replaces what it generated without the namespace in its key",
+			resultCount: 3,
+			results:     "[info] traefik.containo.us/v1alpha1/IngressRoute/testapp-http spec.routes: updated IngressRoute testapp-http",
+			expected: `
+  name: testapp-http
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/shop/testapp-networking'
+spec:`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: testapp-http
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    routes:
+    - match: Path(` + "`/stale`" + `)
+      kind: Rule
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+    namespace: shop
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "vpn route without network profiles",
+			resultCount: 4,
+			results:     "[warning] spec.networkProfiles: vpn routes use the shared Middleware traefik/vpn-only, which has to exist in the cluster, declare networkProfiles to generate the allowlist",
+			expected: `
+  - kind: Rule
+    match: Host(` + "`domain1.test.com`" + `) && PathPrefix(` + "`/admin`" + `)
+    middlewares:
+    - name: vpn-only
+      namespace: traefik`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - pathPrefix: /admin
+      vpn: true`,
+		},
+		{
+			name:        "gateway-api output",
+			resultCount: 5,
+			expected: `  parentRefs:
+  - name: internal
+    namespace: gateways
+  rules:
+  - backendRefs:
+    - name: testapp
+      port: 8000
+    matches:
+    - path:
+        type: PathPrefix
+        value: /admin`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: gateway-api
+    gateway:
+      name: public
+      namespace: gateways
+      sectionName: https
+      vpn:
+        name: internal
+        namespace: gateways
+    grpc: true
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)
+    - match: PathPrefix(` + "`/admin`" + `)
+      vpn: true`,
+		},
+		{
+			name:        "gateway-api output without a gateway",
+			resultCount: 1,
+			errorMsg:    "gateway-api output needs gateway.name",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: gateway-api
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "ingress output",
+			resultCount: 5,
+			expected: `kind: Ingress
+metadata:
+  annotations:
+    nginx.ingress.kubernetes.io/whitelist-source-range: 10.0.0.0/8,192.168.0.0/16
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+  creationTimestamp: null
+  name: testapp-vpn
+spec:
+  ingressClassName: nginx
+  rules:
+  - host: domain1.test.com
+    http:
+      paths:
+      - backend:
+          service:
+            name: testapp
+            port:
+              number: 8000
+        path: /admin
+        pathType: Prefix
+  tls:
+  - hosts:
+    - domain1.test.com
+    secretName: testapp-cert`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: ingress
+    ingress:
+      vpnSourceRanges:
+      - 10.0.0.0/8
+      - 192.168.0.0/16
+    grpc: true
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)
+    - match: PathPrefix(` + "`/admin`" + `)
+      vpn: true`,
+		},
+		{
+			name:        "ingress output without hosts",
+			resultCount: 3,
+			results:     "[warning] spec.hosts: hosts is empty, routes match any host and no certificate is issued",
+			expected: `kind: Ingress
+metadata:
+  creationTimestamp: null
+  name: testapp-http
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ingressClassName: nginx
+  rules:
+  - http:
+      paths:
+      - backend:
+          service:
+            name: testapp
+            port:
+              number: 8000
+        path: /test1
+        pathType: Exact`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: ingress
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "ingress output with an unknown class",
+			resultCount: 1,
+			errorMsg:    "grpc is not supported for ingress class haproxy",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: ingress
+    ingress:
+      className: haproxy
+    grpc: true
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "typed route match",
+			resultCount: 3,
+			expected:    "  - kind: Rule\n    match: (Host(`domain1.test.com`) || Host(`domain2.test.com`)) && PathPrefix(`/api`) && Method(`GET`) && Headers(`X-Env`, `dev`)",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    - domain2.test.com
+    routes:
+    - pathPrefix: /api
+      methods:
+      - GET
+      headers:
+        X-Env: dev`,
+		},
+		{
+			name:        "invalid raw route match",
+			resultCount: 1,
+			errorMsg:    "[error] spec.routes[1]: invalid match PathPrefx(`/api`): unknown matcher PathPrefx",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - path: /health
+    - match: PathPrefx(` + "`/api`" + `)`,
+		},
+		{
+			name:        "per route hosts",
+			resultCount: 3,
+			expected:    "  - kind: Rule\n    match: Host(`admin.test.internal`) && PathPrefix(`/admin`)",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - admin.test.internal
+    - www.test.com
+    routes:
+    - pathPrefix: /admin
+      hosts:
+      - admin.test.internal
+    - pathPrefix: /public
+      hosts:
+      - www.test.com
+    - path: /health`,
+		},
+		{
+			name:        "certificate covers all hosts",
+			resultCount: 3,
+			expected:    "  dnsNames:\n  - admin.test.internal\n  - www.test.com",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - admin.test.internal
+    - www.test.com
+    routes:
+    - pathPrefix: /admin
+      hosts:
+      - admin.test.internal
+    - pathPrefix: /public
+      hosts:
+      - www.test.com
+    - path: /health`,
+		},
+		{
+			name:        "gateway-api routes per host set",
+			resultCount: 5,
+			expected: `  name: testapp-http-1
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  hostnames:
+  - www.test.com`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: gateway-api
+    gateway:
+      name: public
+    hosts:
+    - admin.test.internal
+    - www.test.com
+    routes:
+    - pathPrefix: /admin
+      hosts:
+      - admin.test.internal
+    - pathPrefix: /public
+      hosts:
+      - www.test.com
+    - path: /health`,
+		},
+		{
+			name:        "route host that is not declared",
+			resultCount: 1,
+			errorMsg:    "spec.routes[0].hosts: route host api.test.com is not one of the declared hosts [www.test.com]",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      hosts:
+      - api.test.com`,
+		},
+		{
+			name:        "route policies render middlewares",
+			resultCount: 8,
+			expected: `
+    middlewares:
+    - name: testapp-route0-rate-limit
+    - name: testapp-route0-headers
+    - name: testapp-route0-strip-prefix
+    - name: testapp-route0-compress
+    services:
+    - name: testapp
+      port: 8000
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && Path(` + "`/admin`" + `)
+    middlewares:
+    - name: testapp-route1-basic-auth
+    services:
+    - name: testapp
+      port: 8000
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-route0-rate-limit
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  rateLimit:
+    average: 100
+    burst: 50
+    period: 1s
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-route0-headers
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  headers:
+    accessControlAllowOriginList:
+    - https://www.test.com
+    addVaryHeader: true
+    customRequestHeaders:
+      X-Forwarded-Proto: https
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      stripPrefix: true
+      rateLimit:
+        average: 100
+        burst: 50
+      cors:
+        allowOrigins:
+        - https://www.test.com
+      requestHeaders:
+        X-Forwarded-Proto: https
+      compress: true
+    - path: /admin
+      basicAuth:
+        secret: admin-users`,
+		},
+		{
+			name:        "strip prefix without path prefix",
+			resultCount: 1,
+			errorMsg:    "spec.routes[0]: stripPrefix needs the route to match on pathPrefix",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - path: /api
+      stripPrefix: true`,
+		},
+		{
+			name:        "route policies on ingress output",
+			resultCount: 1,
+			errorMsg:    "ingress output does not support rateLimit on route PathPrefix(`/api`)",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: ingress
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      rateLimit:
+        average: 100`,
+		},
+		{
+			name:        "vpn routes bind to network profiles",
+			resultCount: 5,
+			expected: `
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/reports`" + `)
+    middlewares:
+    - name: testapp-office-allowlist
+    services:
+    - name: testapp
+      port: 8000
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-vpn-allowlist
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ipWhiteList:
+    sourceRange:
+    - 10.8.0.0/16
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-office-allowlist
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ipWhiteList:
+    sourceRange:
+    - 203.0.113.10
+    - 198.51.100.0/24
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    networkProfiles:
+      vpn:
+      - 10.8.0.0/16
+      office:
+      - 203.0.113.10
+      - 198.51.100.0/24
+    routes:
+    - pathPrefix: /admin
+      vpn: true
+    - pathPrefix: /internal
+      vpn: vpn
+    - pathPrefix: /reports
+      vpn: office`,
+		},
+		{
+			name:        "vpn route with unknown network profile",
+			resultCount: 1,
+			errorMsg:    "spec.routes[0].vpn: network profile office is not one of vpn",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    networkProfiles:
+      vpn:
+      - 10.8.0.0/16
+    routes:
+    - pathPrefix: /reports
+      vpn: office`,
+		},
+		{
+			name:        "network profile with invalid range",
+			resultCount: 1,
+			errorMsg:    "spec.networkProfiles: network profile vpn: 10.8.0/16 is not a CIDR or IP",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    networkProfiles:
+      vpn:
+      - 10.8.0/16
+    routes:
+    - pathPrefix: /admin
+      vpn: true`,
+		},
+		{
+			name:        "weighted backends and mirrors",
+			resultCount: 5,
+			expected: `
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/api`" + `)
+    services:
+    - kind: TraefikService
+      name: testapp-route0
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/legacy`" + `)
+    services:
+    - name: legacy
+      port: 80
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: TraefikService
+metadata:
+  creationTimestamp: null
+  name: testapp-route0-weighted
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  weighted:
+    services:
+    - name: testapp
+      port: 8000
+      weight: 3
+    - name: testapp-v2
+      port: 8080
+      weight: 1
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: TraefikService
+metadata:
+  creationTimestamp: null
+  name: testapp-route0
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  mirroring:
+    kind: TraefikService
+    mirrors:
+    - name: testapp-shadow
+      percent: 10
+      port: 80
+    name: testapp-route0-weighted
+---
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      backends:
+      - service: testapp
+        weight: 3
+      - service: testapp-v2
+        port: 8080
+        weight: 1
+      mirrors:
+      - service: testapp-shadow
+        percent: 10
+    - pathPrefix: /legacy
+      backends:
+      - service: legacy`,
+		},
+		{
+			name:        "weighted backends for gateway-api",
+			resultCount: 3,
+			expected: `
+  - backendRefs:
+    - name: testapp
+      port: 8000
+      weight: 3
+    - name: testapp-v2
+      port: 8080
+      weight: 1
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: gateway-api
+    gateway:
+      name: public
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      backends:
+      - service: testapp
+        weight: 3
+      - service: testapp-v2
+        port: 8080
+        weight: 1`,
+		},
+		{
+			name:        "mirror percent out of range",
+			resultCount: 1,
+			errorMsg:    "spec.routes[0]: mirror testapp-shadow percent has to be between 1 and 100",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      mirrors:
+      - service: testapp-shadow
+        percent: 150`,
+		},
+		{
+			name:        "split wildcard certificates from a staging issuer",
+			resultCount: 4,
+			expected: `
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  creationTimestamp: null
+  name: testapp-test-com
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  dnsNames:
+  - '*.test.com'
+  issuerRef:
+    kind: Issuer
+    name: letsencrypt-staging
+  secretName: testapp-test-com-cert
+status: {}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  creationTimestamp: null
+  name: testapp-test-io
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  dnsNames:
+  - test.io
+  issuerRef:
+    kind: Issuer
+    name: letsencrypt-staging
+  secretName: testapp-test-io-cert
+status: {}
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - api.test.com
+    - test.io
+    certificate:
+      wildcard: true
+      split: true
+      issuer:
+        kind: Issuer
+        staging: true
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "split certificates share one per registered domain",
+			resultCount: 4,
+			expected: `
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  creationTimestamp: null
+  name: testapp-test-com
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  dnsNames:
+  - www.test.com
+  - api.test.com
+  issuerRef:
+    kind: ClusterIssuer
+    name: letsencrypt
+  secretName: testapp-test-com-cert
+status: {}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  creationTimestamp: null
+  name: testapp-test-co-id
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  dnsNames:
+  - api.test.co.id
+  - pay.test.co.id
+  issuerRef:
+    kind: ClusterIssuer
+    name: letsencrypt
+  secretName: testapp-test-co-id-cert
+status: {}
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - api.test.co.id
+    - api.test.com
+    - pay.test.co.id
+    certificate:
+      split: true
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "existing tls secret",
+			resultCount: 2,
+			expected: `
+  tls:
+  - hosts:
+    - www.test.com
+    secretName: wildcard-test-com
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: ingress
+    hosts:
+    - www.test.com
+    certificate:
+      secretName: wildcard-test-com
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "existing tls secret with issuer",
+			resultCount: 1,
+			errorMsg:    "spec.certificate: certificate.secretName can not be combined with issuer, wildcard or split",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    certificate:
+      secretName: wildcard-test-com
+      wildcard: true
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "grpc with internal domain, external hosts and methods",
+			resultCount: 5,
+			expected: `
+spec:
+  routes:
+  - kind: Rule
+    match: Host(` + "`testapp.svc.test.internal`" + `) && (Path(` + "`/payments.v1.Payments/Charge`" + `) || PathPrefix(` + "`/payments.v1.Refunds/`" + `))
+    services:
+    - name: testapp
+      passHostHeader: true
+      port: 9000
+      scheme: h2c
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-grpc-external
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  routes:
+  - kind: Rule
+    match: Host(` + "`grpc.test.com`" + `) && (Path(` + "`/payments.v1.Payments/Charge`" + `) || PathPrefix(` + "`/payments.v1.Refunds/`" + `))
+    services:
+    - name: testapp
+      passHostHeader: true
+      port: 9000
+      scheme: h2c
+  tls:
+    secretName: testapp-cert
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - grpc.test.com
+    grpc:
+      internalDomain: svc.test.internal
+      hosts:
+      - grpc.test.com
+      methods:
+      - /payments.v1.Payments/Charge
+      - /payments.v1.Refunds/
+    routes:
+    - pathPrefix: /
+      hosts:
+      - www.test.com`,
+		},
+		{
+			name:        "grpc method that is not a grpc path",
+			resultCount: 1,
+			errorMsg:    "spec.grpc: grpc method payments.v1.Payments.Charge has to look like /package.Service/Method or /package.Service/",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    grpc:
+      methods:
+      - payments.v1.Payments.Charge
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "grpc external host that is not declared",
+			resultCount: 1,
+			errorMsg:    "spec.grpc: route host grpc.test.com is not one of the declared hosts [www.test.com]",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    grpc:
+      hosts:
+      - grpc.test.com
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "tcp and udp routes",
+			resultCount: 6,
+			expected: `
+spec:
+  entryPoints:
+  - mqtt
+  routes:
+  - match: HostSNI(` + "`mqtt.test.com`" + `)
+    services:
+    - name: testapp
+      port: 8883
+  tls:
+    secretName: testapp-cert
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRouteTCP
+metadata:
+  creationTimestamp: null
+  name: testapp-tcp-postgres
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  entryPoints:
+  - postgres
+  routes:
+  - match: HostSNI(` + "`db.test.com`" + `)
+    services:
+    - name: testapp
+      port: 5432
+  tls:
+    passthrough: true
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRouteUDP
+metadata:
+  creationTimestamp: null
+  name: testapp-udp-syslog
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  entryPoints:
+  - syslog
+  routes:
+  - services:
+    - name: testapp
+      port: 514
+---
+apiVersion: v1
+kind: Service
+metadata:
+  creationTimestamp: null
+  labels:
+    app: testapp
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ports:
+  - name: https
+    port: 8000
+    targetPort: 8000
+  - name: mqtt
+    port: 8883
+    targetPort: 8883
+  - name: postgres
+    port: 5432
+    targetPort: 5432
+  - name: syslog
+    port: 514
+    protocol: UDP
+    targetPort: 514
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: mqtt
+            containerPort: 8883
+          - name: postgres
+            containerPort: 5432
+          - name: syslog
+            containerPort: 514
+            protocol: UDP
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - mqtt.test.com
+    routes:
+    - pathPrefix: /
+    tcpRoutes:
+    - port: mqtt
+      entryPoints: [mqtt]
+      sni: [mqtt.test.com]
+      tls: {}
+    - port: postgres
+      entryPoints: [postgres]
+      sni: [db.test.com]
+      tls:
+        passthrough: true
+    udpRoutes:
+    - port: syslog
+      entryPoints: [syslog]`,
+		},
+		{
+			name:        "udp route on a tcp port",
+			resultCount: 1,
+			errorMsg:    "spec.udpRoutes[0].port: container port mqtt is TCP, expected UDP",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: mqtt
+            containerPort: 8883
+          - name: postgres
+            containerPort: 5432
+          - name: syslog
+            containerPort: 514
+            protocol: UDP
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    udpRoutes:
+    - port: mqtt
+      entryPoints: [mqtt]`,
+		},
+		{
+			name:        "tcp route with sni and no tls",
+			resultCount: 1,
+			errorMsg:    "spec.tcpRoutes[0].sni: sni matching needs tls",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: mqtt
+            containerPort: 8883
+          - name: postgres
+            containerPort: 5432
+          - name: syslog
+            containerPort: 514
+            protocol: UDP
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    tcpRoutes:
+    - port: postgres
+      entryPoints: [postgres]
+      sni: [db.test.com]`,
+		},
+		{
+			name:        "network policies from dependencies",
+			resultCount: 5,
+			expected: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  creationTimestamp: null
+  name: testapp-default-deny
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  podSelector:
+    matchLabels:
+      app: testapp
+  policyTypes:
+  - Ingress
+  - Egress
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  creationTimestamp: null
+  name: testapp-allow
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  egress:
+  - to:
+    - podSelector:
+        matchLabels:
+          app: payments
+  - ports:
+    - port: 53
+      protocol: UDP
+    - port: 53
+      protocol: TCP
+    to:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: kube-system
+      podSelector:
+        matchLabels:
+          k8s-app: kube-dns
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          app: orders
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: shop
+      podSelector:
+        matchLabels:
+          part-of: checkout
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: traefik
+  podSelector:
+    matchLabels:
+      app: testapp
+  policyTypes:
+  - Ingress
+  - Egress
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    networkPolicy:
+      from:
+      - app: orders
+      - partOf: checkout
+        namespace: shop
+      to:
+      - app: payments`,
+		},
+		{
+			name:        "network policy peer without labels",
+			resultCount: 1,
+			errorMsg:    "spec.networkPolicy.to[0]: a peer needs app or partOf",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    networkPolicy:
+      to:
+      - namespace: payments`,
+		},
+		{
+			name:        "network policies without dependencies leave egress alone",
+			resultCount: 5,
+			expected: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  creationTimestamp: null
+  name: testapp-default-deny
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  podSelector:
+    matchLabels:
+      app: testapp
+  policyTypes:
+  - Ingress
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  creationTimestamp: null
+  name: testapp-allow
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          app: orders
+  - from:
+    - namespaceSelector:
+        matchLabels:
+          kubernetes.io/metadata.name: traefik
+  podSelector:
+    matchLabels:
+      app: testapp
+  policyTypes:
+  - Ingress
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    networkPolicy:
+      from:
+      - app: orders`,
+		},
+		{
+			name:        "istio virtual service with timeouts and retries",
+			resultCount: 4,
+			expected: `apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  creationTimestamp: null
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  gateways:
+  - istio-system/public
+  hosts:
+  - www.test.com
+  - api.test.com
+  http:
+  - match:
+    - authority:
+        exact: api.test.com
+      uri:
+        prefix: /api
+    name: route0
+    retries:
+      attempts: 3
+      perTryTimeout: 0.5s
+      retryOn: 5xx,connect-failure
+    route:
+    - destination:
+        host: testapp
+        port:
+          number: 8000
+      weight: 67
+    - destination:
+        host: testapp-canary
+        port:
+          number: 80
+      weight: 33
+    timeout: 60s
+---
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  creationTimestamp: null
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  host: testapp
+  trafficPolicy:
+    tls:
+      mode: ISTIO_MUTUAL
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: istio
+    istio:
+      gateway: istio-system/public
+    hosts:
+    - www.test.com
+    - api.test.com
+    routes:
+    - pathPrefix: /api
+      hosts:
+      - api.test.com
+      timeout: 1m
+      retries:
+        attempts: 3
+        perTryTimeout: 500ms
+        retryOn:
+        - 5xx
+        - connect-failure
+      backends:
+      - service: testapp
+        weight: 2
+      - service: testapp-canary
+        weight: 1`,
+		},
+		{
+			name:        "istio gateway and vpn authorization policy",
+			resultCount: 6,
+			expected: `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  creationTimestamp: null
+  name: testapp-office-allowlist
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  action: DENY
+  rules:
+  - from:
+    - source:
+        notRemoteIpBlocks:
+        - 10.8.0.0/16
+    to:
+    - operation:
+        hosts:
+        - www.test.com
+        methods:
+        - GET
+        paths:
+        - /admin*
+  selector:
+    matchLabels:
+      app: testapp
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: istio
+    hosts:
+    - www.test.com
+    networkProfiles:
+      office:
+      - 10.8.0.0/16
+    routes:
+    - pathPrefix: /
+    - pathPrefix: /admin
+      methods:
+      - GET
+      vpn: office`,
+		},
+		{
+			name:        "istio without hosts",
+			resultCount: 5,
+			expected: `spec:
+  selector:
+    istio: ingressgateway
+  servers:
+  - hosts:
+    - '*'
+    port:
+      name: http
+      number: 80
+      protocol: HTTP
+---
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  creationTimestamp: null
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  gateways:
+  - testapp
+  hosts:
+  - '*'
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: istio
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "istio vpn route without network profiles",
+			resultCount: 1,
+			errorMsg:    "vpn route PathPrefix(`/admin`) needs networkProfiles for istio output",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: istio
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /admin
+      vpn: true`,
+		},
+		{
+			name:        "traefik timeout, retries and backend tls",
+			resultCount: 5,
+			expected: `apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-http
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  routes:
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/reports`" + `)
+    middlewares:
+    - name: testapp-route0-retry
+    services:
+    - name: testapp
+      port: 8000
+      scheme: https
+      serversTransport: testapp-route0
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-route0-retry
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  retry:
+    attempts: 3
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: ServersTransport
+metadata:
+  creationTimestamp: null
+  name: testapp-route0
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  forwardingTimeouts:
+    responseHeaderTimeout: 2m
+  insecureSkipVerify: true
+  serverName: testapp.internal
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /reports
+      timeout: 2m
+      retries:
+        attempts: 3
+      backendTLS:
+        serverName: testapp.internal
+        insecureSkipVerify: true`,
+		},
+		{
+			name:        "retry conditions on traefik output",
+			resultCount: 1,
+			errorMsg:    "traefik output does not support retries.perTryTimeout and retries.retryOn on route PathPrefix(`/`)",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+      retries:
+        attempts: 3
+        retryOn:
+        - 5xx`,
+		},
+		{
+			name:        "dns endpoint for hosts",
+			resultCount: 4,
+			expected: `apiVersion: externaldns.k8s.io/v1alpha1
+kind: DNSEndpoint
+metadata:
+  creationTimestamp: null
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  endpoints:
+  - dnsName: www.test.com
+    recordTTL: 300
+    recordType: CNAME
+    targets:
+    - lb.test.com
+  - dnsName: api.test.com
+    recordTTL: 300
+    recordType: CNAME
+    targets:
+    - lb.test.com
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - api.test.com
+    routes:
+    - pathPrefix: /
+    dns:
+      targets:
+      - lb.test.com
+      ttl: 300`,
+		},
+		{
+			name:        "dns annotations on routes",
+			resultCount: 3,
+			expected: `apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-http
+  annotations:
+    external-dns.alpha.kubernetes.io/target: '10.0.0.1,10.0.0.2'
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    dns:
+      mode: annotations
+      targets:
+      - 10.0.0.1
+      - 10.0.0.2`,
+		},
+		{
+			name:        "dns record type not fitting targets",
+			resultCount: 1,
+			errorMsg:    "spec.dns: dns recordType AAAA does not fit targets 10.0.0.1",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    dns:
+      recordType: AAAA
+      targets:
+      - 10.0.0.1`,
+		},
+		{
+			name:        "legacy data with deprecation warning",
+			resultCount: 4,
+			expected: `apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-http
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  data:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "legacy data with unknown fields",
+			resultCount: 5,
+			results:     `[warning] data: data has fields the function does not know, they are ignored: unknown field "vpnOnly"`,
+			expected: `apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-http
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  data:
+    app: testapp
+    vpnOnly: true
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "unknown field",
+			resultCount: 1,
+			errorMsg:    `json: unknown field "pathPrefx"`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefx: /`,
+		},
+		{
+			name:        "spec and legacy data",
+			resultCount: 1,
+			errorMsg:    "spec and the deprecated data can not both be set",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+  data:
+    app: testapp`,
+		},
+		{
+			name:        "route overlaps a hand-written IngressRoute",
+			resultCount: 1,
+			errorMsg:    "IngressRoute testapp-http route 0 overlaps IngressRoute legacy-http route 0, both match PathPrefix(`/api`) on host www.test.com with priority 0",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: legacy-http
+  spec:
+    routes:
+    - kind: Rule
+      match: Host(` + "`api.test.com`" + `, ` + "`www.test.com`" + `) && PathPrefix(` + "`/api`" + `)
+      services:
+      - name: legacy
+        port: 80
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api`,
+		},
+		{
+			name:        "overlap with a priority",
+			resultCount: 3,
+			expected: `
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/api`" + `)
+    priority: 10`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: legacy-http
+  spec:
+    routes:
+    - kind: Rule
+      match: Host(` + "`api.test.com`" + `, ` + "`www.test.com`" + `) && PathPrefix(` + "`/api`" + `)
+      services:
+      - name: legacy
+        port: 80
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api
+      priority: 10`,
+		},
+		{
+			name:        "route shadowed by a broader hand-written route",
+			resultCount: 1,
+			errorMsg:    "IngressRoute legacy-http route 0 shadows IngressRoute testapp-http route 0 on host www.test.com, it matches PathPrefix(`/`) with priority 100 and the narrower route has 48, give IngressRoute testapp-http route 0 a higher priority",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: legacy-http
+  spec:
+    routes:
+    - kind: Rule
+      match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/`" + `)
+      priority: 100
+      services:
+      - name: legacy
+        port: 80
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /api/users`,
+		},
+		{
+			name:        "https and canonical host redirects",
+			resultCount: 7,
+			expected: `
+spec:
+  entryPoints:
+  - websecure
+  routes:
+  - kind: Rule
+    match: Host(` + "`test.com`" + `) && PathPrefix(` + "`/`" + `)
+    services:
+    - name: testapp
+      port: 8000
+  tls:
+    secretName: testapp-cert
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-web
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  entryPoints:
+  - web
+  routes:
+  - kind: Rule
+    match: Host(` + "`test.com`, `www.test.com`" + `)
+    middlewares:
+    - name: testapp-https-redirect
+    services:
+    - kind: TraefikService
+      name: noop@internal
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-host-redirect
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  entryPoints:
+  - websecure
+  routes:
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `)
+    middlewares:
+    - name: testapp-host-redirect0
+    services:
+    - kind: TraefikService
+      name: noop@internal
+  tls:
+    secretName: testapp-cert
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-https-redirect
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  redirectScheme:
+    permanent: true
+    scheme: https
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: Middleware
+metadata:
+  creationTimestamp: null
+  name: testapp-host-redirect0
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  redirectRegex:
+    permanent: true
+    regex: ^https?://www\.test\.com(:[0-9]+)?/(.*)
+    replacement: https://test.com/${2}
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - test.com
+    - www.test.com
+    redirects:
+      https: true
+      permanent: true
+      hosts:
+      - from: www.test.com
+        to: test.com
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "redirect to an undeclared host",
+			resultCount: 1,
+			errorMsg:    "[error] spec.redirects: redirect from www.test.com to test.org has to be between declared hosts [test.com www.test.com]",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - test.com
+    - www.test.com
+    redirects:
+      https: true
+      permanent: true
+      hosts:
+      - from: www.test.com
+        to: test.org
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "client auth",
+			resultCount: 6,
+			expected: `
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-mtls-partner-ca
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  routes:
+  - kind: Rule
+    match: Host(` + "`partner.test.com`" + `) && PathPrefix(` + "`/partner`" + `)
+    services:
+    - name: testapp
+      port: 8000
+  tls:
+    options:
+      name: testapp-mtls-partner-ca
+    secretName: testapp-cert
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: TLSOption
+metadata:
+  creationTimestamp: null
+  name: testapp-mtls-partner-ca
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  clientAuth:
+    clientAuthType: RequireAndVerifyClientCert
+    secretNames:
+    - partner-ca
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - partner.test.com
+    routes:
+    - pathPrefix: /
+      hosts: [www.test.com]
+    - pathPrefix: /partner
+      hosts: [partner.test.com]
+      clientAuth:
+        caSecret: partner-ca
+        issuer:
+          name: selfsigned`,
+		},
+		{
+			name:        "client auth CA certificate",
+			resultCount: 6,
+			expected: `
+kind: Certificate
+metadata:
+  creationTimestamp: null
+  name: partner-ca
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  commonName: partner-ca
+  isCA: true
+  issuerRef:
+    kind: ClusterIssuer
+    name: selfsigned
+  secretName: partner-ca
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - partner.test.com
+    routes:
+    - pathPrefix: /
+      hosts: [www.test.com]
+    - pathPrefix: /partner
+      hosts: [partner.test.com]
+      clientAuth:
+        caSecret: partner-ca
+        issuer:
+          name: selfsigned`,
+		},
+		{
+			name:        "client auth on a shared host",
+			resultCount: 1,
+			errorMsg:    "[error] spec.routes: host partner.test.com has routes with different clientAuth, TLS options apply to the whole host",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    - partner.test.com
+    routes:
+    - pathPrefix: /
+    - pathPrefix: /partner
+      hosts: [partner.test.com]
+      clientAuth:
+        caSecret: partner-ca
+        issuer:
+          name: selfsigned`,
+		},
+		{
+			name:        "results for generated, updated and pruned resources",
+			resultCount: 5,
+			results: `[warning] apps/v1/Deployment/testapp spec.template.spec.containers: Deployment testapp has no https or http container port, routes to Service testapp use port 80, which it does not expose
+
+[info] traefik.containo.us/v1alpha1/IngressRoute/testapp-http spec.routes: updated IngressRoute testapp-http
+
+[info] v1/Service/testapp spec.app: updated Service testapp
+
+[info] cert-manager.io/v1/Certificate/testapp spec.hosts: generated Certificate testapp
+
+[info] traefik.containo.us/v1alpha1/Middleware/testapp-route0-compress: pruned Middleware testapp-route0-compress, LummoNetworking/testapp-networking no longer generates it`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: web
+            containerPort: 8000
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: echo-server
+    annotations:
+      app.tokko.io/owner: team-a
+  spec:
+    ports:
+    - port: 80
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: IngressRoute
+  metadata:
+    name: testapp-http
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    routes:
+    - match: Path(` + "`/stale`" + `)
+      kind: Rule
+- apiVersion: traefik.containo.us/v1alpha1
+  kind: Middleware
+  metadata:
+    name: testapp-route0-compress
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    compress: {}
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: testapp
+    annotations:
+      app.tokko.io/generated-by: LummoNetworking/testapp-networking
+  spec:
+    ports:
+    - port: 80
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - domain1.test.com
+    routes:
+    - match: Path(` + "`/test1`" + `)`,
+		},
+		{
+			name:        "empty hosts match any host",
+			resultCount: 3,
+			results:     "[warning] spec.hosts: hosts is empty, routes match any host and no certificate is issued",
+			expected: `
+  routes:
+  - kind: Rule
+    match: PathPrefix(` + "`/`" + `)`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "service ports from named container ports",
+			resultCount: 4,
+			expected: `
+  routes:
+  - kind: Rule
+    match: Host(` + "`www.test.com`" + `) && PathPrefix(` + "`/`" + `)
+    services:
+    - name: testapp
+      port: 8080
+---
+apiVersion: traefik.containo.us/v1alpha1
+kind: IngressRoute
+metadata:
+  creationTimestamp: null
+  name: testapp-grpc
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  routes:
+  - kind: Rule
+    match: Host(` + "`testapp.internal.bukukas.k8s`" + `)
+    services:
+    - name: testapp
+      passHostHeader: true
+      port: 9000
+      scheme: h2c
+---
+apiVersion: v1
+kind: Service
+metadata:
+  creationTimestamp: null
+  labels:
+    app: testapp
+  name: testapp
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  ports:
+  - appProtocol: http
+    name: https
+    port: 8080
+    targetPort: 8000
+  - appProtocol: kubernetes.io/h2c
+    name: grpc
+    port: 9000
+    targetPort: 9000
+  selector:
+    app: testapp
+  sessionAffinity: ClientIP
+  sessionAffinityConfig:
+    clientIP:
+      timeoutSeconds: 600
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    grpc: true
+    service:
+      ports:
+      - name: https
+        port: 8080
+        appProtocol: http
+      - name: grpc
+        appProtocol: kubernetes.io/h2c
+      sessionAffinity: ClientIP
+      sessionAffinityTimeout: 600
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "service ports on the same port",
+			resultCount: 1,
+			errorMsg:    "[error] spec.service: container ports https and http are both exposed on service port 8000/TCP, set service.ports for one of them",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+          - name: http
+            containerPort: 8001
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    grpc: true
+    service:
+      ports:
+      - name: grpc
+        appProtocol: kubernetes.io/h2c
+      - name: http
+        port: 8000
+      sessionAffinity: ClientIP
+      sessionAffinityTimeout: 600
+    routes:
+    - pathPrefix: /`,
+		},
+		{
+			name:        "internal load balancer with a static IP",
+			resultCount: 5,
+			results:     "[info] compute.cnrm.cloud.google.com/v1beta1/ComputeAddress/testapp-internal spec.internal: generated ComputeAddress testapp-internal",
+			expected: `
+apiVersion: v1
+kind: Service
+metadata:
+  annotations:
+    networking.gke.io/internal-load-balancer-allow-global-access: "true"
+    networking.gke.io/load-balancer-type: Internal
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+  creationTimestamp: null
+  name: testapp-internal
+spec:
+  loadBalancerIP: 10.1.2.3
+  loadBalancerSourceRanges:
+  - 10.0.0.0/8
+  ports:
+  - name: grpc
+    port: 9000
+    targetPort: 9000
+  selector:
+    app: testapp
+  type: LoadBalancer
+status:
+  loadBalancer: {}
+---
+apiVersion: compute.cnrm.cloud.google.com/v1beta1
+kind: ComputeAddress
+metadata:
+  creationTimestamp: null
+  name: testapp-internal
+  annotations:
+    app.tokko.io/generated-by: 'LummoNetworking/testapp-networking'
+spec:
+  address: 10.1.2.3
+  addressType: INTERNAL
+  description: internal load balancer of testapp
+  location: asia-southeast2
+  subnetworkRef:
+    external: projects/p/regions/asia-southeast2/subnetworks/s
+`,
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    internal:
+      ports:
+      - grpc
+      sourceRanges:
+      - 10.0.0.0/8
+      globalAccess: true
+      staticIP:
+        address: 10.1.2.3
+        region: asia-southeast2
+        subnetwork: projects/p/regions/asia-southeast2/subnetworks/s`,
+		},
+		{
+			name:        "internal port not on the service",
+			resultCount: 1,
+			errorMsg:    "[error] spec.internal: internal port metrics is not a port of Service testapp",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    internal:
+      ports:
+      - metrics`,
+		},
+		{
+			name:        "internal source range not a CIDR",
+			resultCount: 1,
+			errorMsg:    "[error] spec.internal: internal source range 10.0.0.1 is not a CIDR",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: testapp
+    labels:
+      app: testapp
+  spec:
+    template:
+      spec:
+        containers:
+        - name: testapp
+          ports:
+          - name: https
+            containerPort: 8000
+          - name: grpc
+            containerPort: 9000
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+    internal:
+      ports:
+      - grpc
+      sourceRanges:
+      - 10.0.0.1`,
+		},
+		{
+			name:        "schema rejects an unknown output",
+			resultCount: 1,
+			errorMsg:    "spec.output in body should be one of [traefik gateway-api ingress istio]",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    output: nginx
+    hosts:
+    - www.test.com`,
+		},
+		{
+			name:        "schema rejects a negative route priority",
+			resultCount: 1,
+			errorMsg:    "spec.routes[0].priority in body should be greater than or equal to 0",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: v1
+  kind: LummoNetworking
+  metadata:
+    name: testapp-networking
+  spec:
+    app: testapp
+    hosts:
+    - www.test.com
+    routes:
+    - pathPrefix: /
+      priority: -1`,
+		},
+	}
+	runTests(t, tests)
+}
+
+func runTests(t *testing.T, tests []test) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := &kio.ByteReader{
+				Reader:                bytes.NewBufferString(test.input),
+				OmitReaderAnnotations: true,
+			}
+			items, err := reader.Read()
+			if !assert.NoError(t, err, test.name) {
+				t.FailNow()
+			}
+
+			resourceList := &framework.ResourceList{
+				Items:          items,
+				FunctionConfig: reader.FunctionConfig,
+			}
+			err = Process(resourceList)
+
+			if test.errorMsg != "" {
+				if !assert.NotNil(t, err, test.name) {
+					t.FailNow()
+				}
+				if !assert.Contains(t, err.Error(), test.errorMsg) {
+					t.FailNow()
+				}
+			}
+
+			if test.errorMsg == "" && !assert.NoError(t, err, test.name) {
+				t.FailNow()
+			}
+
+			if !assert.Equal(t, test.resultCount, len(resourceList.Results), test.name) {
+				t.FailNow()
+			}
+
+			if test.results != "" && !assert.Contains(t, resourceList.Results.Error(), test.results, test.name) {
+				t.FailNow()
+			}
+
+			if test.expected != "" {
+				out, err := kio.StringAll(resourceList.Items)
+				if !assert.NoError(t, err, test.name) {
+					t.FailNow()
+				}
+				if !assert.Contains(t, out, test.expected, test.name) {
+					t.FailNow()
+				}
+			}
+		})
+	}
+}
+
+// TestWorkloadsService chains the workloads function into this one, like the example
+// kustomization does, both have to build the same Service for the app
+func TestWorkloadsService(t *testing.T) {
+	workloadsConfig := workloads.FunctionConfig{}
+	err := k8syaml.Unmarshal([]byte(`
+apiVersion: lummoKRM/v1
+kind: LummoDeployment
+metadata:
+  name: foobar-api
+spec:
+  part-of: foobar
+  app: foobar-api
+  containers:
+  - name: foobar-api
+    image: foobar
+    grpc:
+      port: 3000
+    http:
+      port: 2000`), &workloadsConfig)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	items, err := workloadsConfig.Filter(nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	expected := corev1.Service{}
+	for _, item := range items {
+		if item.GetKind() == "Service" {
+			assert.NoError(t, k8syaml.Unmarshal([]byte(item.MustString()), &expected))
+		}
+	}
+	if !assert.Len(t, expected.Spec.Ports, 2) {
+		t.FailNow()
+	}
+
+	reader := &kio.ByteReader{
+		Reader: bytes.NewBufferString(`
+apiVersion: v1
+kind: LummoNetworking
+metadata:
+  name: foobar-networking
+spec:
+  app: foobar-api
+  hosts:
+  - foo.com
+  routes:
+  - pathPrefix: /`),
+		OmitReaderAnnotations: true,
+	}
+	functionConfig, err := reader.Read()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	resourceList := &framework.ResourceList{Items: items, FunctionConfig: functionConfig[0]}
+	if !assert.NoError(t, Process(resourceList)) {
+		t.FailNow()
+	}
+	var services []corev1.Service
+	for _, item := range resourceList.Items {
+		if item.GetKind() == "Service" {
+			svc := corev1.Service{}
+			assert.NoError(t, k8syaml.Unmarshal([]byte(item.MustString()), &svc))
+			services = append(services, svc)
+		}
+	}
+	if !assert.Len(t, services, 1) {
+		t.FailNow()
 	}
-	runTests(t, tests)
-}
-
-func runTests(t *testing.T, tests []test) {
-	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			baseDir, err := ioutil.TempDir("", "")
-			if !assert.NoError(t, err, test.name) {
-				t.FailNow()
-			}
-			defer os.RemoveAll(baseDir)
-
-			r, err := ioutil.TempFile(baseDir, "fn-*.yaml")
-			if !assert.NoError(t, err, test.name) {
-				t.FailNow()
-			}
-			defer os.Remove(r.Name())
-			err = ioutil.WriteFile(r.Name(), []byte(test.input), 0600)
-			if !assert.NoError(t, err, test.name) {
-				t.FailNow()
-			}
-
-			injector := &networking.InjectRoutes{}
-			inout := &kio.LocalPackageReadWriter{
-				PackagePath: baseDir,
-			}
-			err = kio.Pipeline{
-				Inputs:  []kio.Reader{inout},
-				Filters: []kio.Filter{injector},
-				Outputs: []kio.Writer{inout},
-			}.Execute()
-
-			if test.errorMsg != "" {
-				if !assert.NotNil(t, err, test.name) {
-					t.FailNow()
-				}
-				if !assert.Contains(t, err.Error(), test.errorMsg) {
-					t.FailNow()
-				}
-			}
-
-			if test.errorMsg == "" && !assert.NoError(t, err, test.name) {
-				t.FailNow()
-			}
-
-			// get results
-			results, err := injector.Results()
-			if !assert.NoError(t, err, test.name, test.name) {
-				t.FailNow()
-			}
-			if !assert.Equal(t, test.resultCount, len(results), test.name) {
-				t.FailNow()
-			}
-
-		})
-	}
+	assert.Equal(t, expected.Labels, services[0].Labels)
+	assert.Equal(t, expected.Spec, services[0].Spec)
 }
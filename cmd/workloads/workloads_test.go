@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/kio/filters"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// TestMain runs the tests from the repository root, the function reads the CRD make crd
+// generates from the working directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// TestKustomizeTransformers runs the example kustomization the way kustomize does: each
+// transformer gets the resources and the previous transformers' output
+func TestKustomizeTransformers(t *testing.T) {
+	dir := "example/workloads"
+	data, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var kustomization struct {
+		Resources    []string `json:"resources"`
+		Transformers []string `json:"transformers"`
+	}
+	if !assert.NoError(t, k8syaml.Unmarshal(data, &kustomization)) {
+		t.FailNow()
+	}
+
+	var items []*kyaml.RNode
+	for _, file := range kustomization.Resources {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		nodes, err := kio.FromBytes(data)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		items = append(items, nodes...)
+	}
+	for _, file := range kustomization.Transformers {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		config, err := kyaml.Parse(string(data))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		in := &bytes.Buffer{}
+		err = kio.ByteWriter{
+			Writer:             in,
+			WrappingKind:       kio.ResourceListKind,
+			WrappingAPIVersion: kio.ResourceListAPIVersion,
+			FunctionConfig:     config,
+		}.Write(items)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		out := &bytes.Buffer{}
+		c := cmd()
+		c.SetIn(in)
+		c.SetOut(out)
+		c.SetArgs([]string{})
+		if !assert.NoError(t, c.Execute(), file) {
+			t.FailNow()
+		}
+		items, err = (&kio.ByteReader{Reader: out, OmitReaderAnnotations: true}).Read()
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	kinds := map[string]*kyaml.RNode{}
+	for _, item := range items {
+		kinds[item.GetKind()+"/"+item.GetName()] = item
+	}
+	template := kinds["LummoContainer/foobar"]
+	if assert.NotNil(t, template) {
+		assert.Equal(t, "true", template.GetAnnotations()[filters.LocalConfigAnnotation])
+	}
+	rollout := kinds["Rollout/foobar-test"]
+	if assert.NotNil(t, rollout) {
+		out := rollout.MustString()
+		assert.Contains(t, out, "image: foobar\n")
+		assert.Contains(t, out, "name: foobar-test\n")
+		assert.Contains(t, out, "name: foobar-api-database-secrets\n")
+		assert.Contains(t, out, "name: foobar-api-config\n")
+	}
+	assert.NotNil(t, kinds["Deployment/foobar-api"])
+}
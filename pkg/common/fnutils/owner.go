@@ -0,0 +1,16 @@
+package fnutils
+
+import "fmt"
+
+// GeneratedByAnnotation marks the resources a function generated, its value is the OwnerKey of
+// the function config that generated them
+const GeneratedByAnnotation = "app.tokko.io/generated-by"
+
+// OwnerKey identifies a function config as <kind>/<namespace>/<name>, or <kind>/<name> when it
+// has no namespace
+func OwnerKey(kind, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
@@ -0,0 +1,182 @@
+// Package service builds the Service of an app from the named ports of its container. The
+// functions that generate an app's Service share it, so they agree on the ports
+package service
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Port overrides how a named container port is exposed
+type Port struct {
+	// Name is the name of the container port
+	Name string `json:"name"`
+	// Port is the Service port, the container port when empty
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// AppProtocol tells ingresses and meshes the port's protocol, like http or kubernetes.io/h2c
+	// +optional
+	AppProtocol string `json:"appProtocol,omitempty"`
+}
+
+// Config is the Service part of a function config
+type Config struct {
+	// Ports override the Service ports of some named container ports
+	// +optional
+	Ports []Port `json:"ports,omitempty"`
+	// Headless gives the Service no cluster IP, so its DNS name resolves to the pods
+	// +optional
+	Headless bool `json:"headless,omitempty"`
+	// SessionAffinity ClientIP sends a client's connections to the same pod
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+	// SessionAffinityTimeout is how long a client sticks to a pod in seconds, 3 hours when empty
+	// +optional
+	SessionAffinityTimeout int32 `json:"sessionAffinityTimeout,omitempty"`
+}
+
+func (c *Config) override(name string) *Port {
+	if c == nil {
+		return nil
+	}
+	for i, p := range c.Ports {
+		if p.Name == name {
+			return &c.Ports[i]
+		}
+	}
+	return nil
+}
+
+// ServicePort is the Service port a container port is exposed on, its container port unless
+// the config overrides it
+func (c *Config) ServicePort(port corev1.ContainerPort) corev1.ServicePort {
+	servicePort := corev1.ServicePort{
+		Name:       port.Name,
+		Port:       port.ContainerPort,
+		Protocol:   port.Protocol,
+		TargetPort: intstr.FromInt(int(port.ContainerPort)),
+	}
+	if o := c.override(port.Name); o != nil {
+		if o.Port != 0 {
+			servicePort.Port = o.Port
+		}
+		if o.AppProtocol != "" {
+			servicePort.AppProtocol = &o.AppProtocol
+		}
+	}
+	return servicePort
+}
+
+// Validate checks the config against the container ports it is applied to
+func (c *Config) Validate(ports []corev1.ContainerPort) error {
+	if c == nil {
+		return nil
+	}
+	named := map[string]bool{}
+	for _, p := range ports {
+		named[p.Name] = p.Name != ""
+	}
+	seen := map[string]bool{}
+	for _, o := range c.Ports {
+		if !named[o.Name] {
+			return fmt.Errorf("service port %s is not a named container port", o.Name)
+		}
+		if seen[o.Name] {
+			return fmt.Errorf("service port %s is configured twice", o.Name)
+		}
+		seen[o.Name] = true
+		if o.Port < 0 || o.Port > 65535 {
+			return fmt.Errorf("service port %s has to be between 1 and 65535, got %d", o.Name, o.Port)
+		}
+	}
+	switch c.SessionAffinity {
+	case "", corev1.ServiceAffinityNone, corev1.ServiceAffinityClientIP:
+	default:
+		return fmt.Errorf("sessionAffinity has to be None or ClientIP, got %s", c.SessionAffinity)
+	}
+	if c.SessionAffinityTimeout != 0 && c.SessionAffinity != corev1.ServiceAffinityClientIP {
+		return fmt.Errorf("sessionAffinityTimeout needs sessionAffinity ClientIP")
+	}
+	if c.SessionAffinityTimeout < 0 || c.SessionAffinityTimeout > 86400 {
+		return fmt.Errorf("sessionAffinityTimeout has to be between 1 and 86400 seconds, got %d", c.SessionAffinityTimeout)
+	}
+	return nil
+}
+
+// labelKeys are the pod labels an app's Service carries and selects on
+var labelKeys = []string{"app", "part-of"}
+
+// Labels are the labels and the selector of the Service of app: its app label, and the part-of
+// label of its pods when they have one
+func Labels(app string, podLabels map[string]string) map[string]string {
+	labels := map[string]string{}
+	for _, k := range labelKeys {
+		if v, ok := podLabels[k]; ok {
+			labels[k] = v
+		}
+	}
+	labels["app"] = app
+	return labels
+}
+
+// Build renders the Service of app for the container ports of its pods. A Service with several
+// ports needs them named, so an unnamed port is an error unless it is the only one
+func Build(app string, podLabels map[string]string, ports []corev1.ContainerPort, conf *Config) (corev1.Service, error) {
+	service := corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   app,
+			Labels: Labels(app, podLabels),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: Labels(app, podLabels),
+		},
+	}
+	if err := conf.Validate(ports); err != nil {
+		return service, err
+	}
+
+	used := map[string]string{}
+	for _, p := range ports {
+		if p.Name == "" && len(ports) > 1 {
+			return service, fmt.Errorf("container port %d has no name, a Service with several ports needs them named", p.ContainerPort)
+		}
+		if p.ContainerPort == 0 {
+			return service, fmt.Errorf("container port %s has no port number", p.Name)
+		}
+		servicePort := conf.ServicePort(p)
+		protocol := servicePort.Protocol
+		if protocol == "" {
+			protocol = corev1.ProtocolTCP
+		}
+		key := fmt.Sprintf("%d/%s", servicePort.Port, protocol)
+		if other, ok := used[key]; ok {
+			return service, fmt.Errorf("container ports %s and %s are both exposed on service port %s, set service.ports for one of them", other, p.Name, key)
+		}
+		used[key] = p.Name
+		service.Spec.Ports = append(service.Spec.Ports, servicePort)
+	}
+
+	if conf == nil {
+		return service, nil
+	}
+	if conf.Headless {
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+	}
+	if conf.SessionAffinity != "" {
+		service.Spec.SessionAffinity = conf.SessionAffinity
+	}
+	if conf.SessionAffinityTimeout != 0 {
+		service.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{
+			ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &conf.SessionAffinityTimeout},
+		}
+	}
+	return service, nil
+}
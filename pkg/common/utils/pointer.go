@@ -0,0 +1,6 @@
+package utils
+
+// PointerTo returns a pointer to a copy of v, handy for optional API fields
+func PointerTo[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,138 @@
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/traefik/traefik/v2/pkg/config/dynamic"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+)
+
+// defaultNetworkProfile is the profile `vpn: true` binds to when the config names none
+const defaultNetworkProfile = "vpn"
+
+// vpnRef is a route's `vpn` field, either true for the default network profile or a profile name
+type vpnRef struct {
+	Enabled bool
+	Profile string
+}
+
+func (v *vpnRef) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*v = vpnRef{Enabled: enabled}
+		return nil
+	}
+	var profile string
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return fmt.Errorf("vpn has to be a bool or a network profile name")
+	}
+	*v = vpnRef{Enabled: profile != "", Profile: profile}
+	return nil
+}
+
+func (v vpnRef) MarshalJSON() ([]byte, error) {
+	if v.Profile != "" {
+		return json.Marshal(v.Profile)
+	}
+	return json.Marshal(v.Enabled)
+}
+
+// allowlist is the network profile a route is restricted to. SourceRanges is nil for the
+// legacy shared vpn-only middleware, used while the config declares no network profiles
+type allowlist struct {
+	Profile      string
+	SourceRanges []string
+	// Default is set when Profile is the one `vpn: true` binds to
+	Default bool
+}
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// validateNetworkProfiles checks the names and CIDRs of all profiles, and that the default exists
+func validateNetworkProfiles(fn *networkingSpec) error {
+	for _, name := range sortedProfileNames(fn.NetworkProfiles) {
+		if !profileNamePattern.MatchString(name) {
+			return fmt.Errorf("network profile name %s has to be a lowercase dns label", name)
+		}
+		ranges := fn.NetworkProfiles[name]
+		if len(ranges) == 0 {
+			return fmt.Errorf("network profile %s has no source ranges", name)
+		}
+		for _, r := range ranges {
+			if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+				return fmt.Errorf("network profile %s: %s is not a CIDR or IP", name, r)
+			}
+		}
+	}
+	if fn.DefaultNetworkProfile != "" && len(fn.NetworkProfiles) > 0 {
+		if _, ok := fn.NetworkProfiles[fn.DefaultNetworkProfile]; !ok {
+			return fmt.Errorf("default network profile %s is not one of the network profiles", fn.DefaultNetworkProfile)
+		}
+	}
+	return nil
+}
+
+func sortedProfileNames(profiles map[string][]string) []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// routeAllowlist resolves a route's vpn field to the network profile it is restricted to
+func routeAllowlist(fn *networkingSpec, v vpnRef) (*allowlist, error) {
+	if !v.Enabled {
+		return nil, nil
+	}
+	defaultName := fn.DefaultNetworkProfile
+	if defaultName == "" {
+		defaultName = defaultNetworkProfile
+	}
+	name := v.Profile
+	if name == "" {
+		name = defaultName
+	}
+	if len(fn.NetworkProfiles) == 0 {
+		if name != defaultName {
+			return nil, fmt.Errorf("network profile %s is not declared in networkProfiles", name)
+		}
+		return &allowlist{Profile: name, Default: true}, nil
+	}
+	ranges, ok := fn.NetworkProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("network profile %s is not one of %s", name, strings.Join(sortedProfileNames(fn.NetworkProfiles), ", "))
+	}
+	return &allowlist{Profile: name, SourceRanges: makeCopy(ranges), Default: name == defaultName}, nil
+}
+
+// usesSharedAllowlist tells if a route falls back to the legacy shared vpn-only middleware,
+// which only works when the cluster has it
+func usesSharedAllowlist(routes []httpRoute) bool {
+	for _, r := range routes {
+		if r.Allowlist != nil && r.Allowlist.SourceRanges == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// traefikAllowlist returns the middleware reference for a, and the middleware itself
+// unless a is the legacy shared one
+func traefikAllowlist(app string, a *allowlist) (traefik.MiddlewareRef, *traefik.Middleware) {
+	if a.SourceRanges == nil {
+		return traefik.MiddlewareRef{Name: "vpn-only", Namespace: "traefik"}, nil
+	}
+	m := newMiddleware(fmt.Sprintf("%s-%s-allowlist", app, a.Profile), traefik.MiddlewareSpec{
+		IPWhiteList: &dynamic.IPWhiteList{
+			SourceRange: a.SourceRanges,
+		},
+	})
+	return traefik.MiddlewareRef{Name: m.Name}, &m
+}
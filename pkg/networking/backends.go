@@ -0,0 +1,273 @@
+package networking
+
+import (
+	"fmt"
+
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	traefikServiceKind   = "TraefikService"
+	serversTransportKind = "ServersTransport"
+	// defaultServicePort is the port routes use for Services other than the app's
+	defaultServicePort = 80
+)
+
+// backendConfig is a Service a route sends a weighted share of its requests to
+type backendConfig struct {
+	Service string `json:"service"`
+	// Port is the Service port. When empty it is the https or http port for the app's Service
+	// and 80 for the others
+	Port int32 `json:"port,omitempty"`
+	// Weight is relative to the route's other backends, 1 when empty
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// mirrorConfig is a Service that gets a copy of a percentage of a route's requests,
+// its responses are dropped
+type mirrorConfig struct {
+	Service string `json:"service"`
+	// Port is the Service port. When empty it is the https or http port for the app's Service
+	// and 80 for the others
+	Port    int32 `json:"port,omitempty"`
+	Percent int   `json:"percent"`
+}
+
+type mirrorRef struct {
+	backendRef
+	Percent int
+}
+
+// routeBackends resolves a route's backends and mirrors, the app's Service when it lists no backends.
+// servicePort is the app Service's http port
+func routeBackends(serviceName string, servicePort int32, backends []backendConfig, mirrors []mirrorConfig) ([]backendRef, []mirrorRef, error) {
+	if len(backends) == 0 {
+		backends = []backendConfig{{Service: serviceName}}
+	}
+
+	var refs []backendRef
+	total := int32(0)
+	for _, b := range backends {
+		if b.Service == "" {
+			return nil, nil, fmt.Errorf("backend service can not be empty")
+		}
+		ref := backendRef{Name: b.Service, Port: b.Port, Weight: 1}
+		if ref.Port == 0 {
+			ref.Port = defaultPort(b.Service, serviceName, servicePort)
+		}
+		if b.Weight != nil {
+			if *b.Weight < 0 {
+				return nil, nil, fmt.Errorf("backend %s weight can not be negative", b.Service)
+			}
+			ref.Weight = *b.Weight
+		}
+		total += ref.Weight
+		refs = append(refs, ref)
+	}
+	if total == 0 {
+		return nil, nil, fmt.Errorf("at least one backend needs a positive weight")
+	}
+
+	var mirrorRefs []mirrorRef
+	for _, m := range mirrors {
+		if m.Service == "" {
+			return nil, nil, fmt.Errorf("mirror service can not be empty")
+		}
+		if m.Percent < 1 || m.Percent > 100 {
+			return nil, nil, fmt.Errorf("mirror %s percent has to be between 1 and 100", m.Service)
+		}
+		ref := mirrorRef{backendRef: backendRef{Name: m.Service, Port: m.Port}, Percent: m.Percent}
+		if ref.Port == 0 {
+			ref.Port = defaultPort(m.Service, serviceName, servicePort)
+		}
+		mirrorRefs = append(mirrorRefs, ref)
+	}
+	return refs, mirrorRefs, nil
+}
+
+func defaultPort(name string, serviceName string, servicePort int32) int32 {
+	if name == serviceName {
+		return servicePort
+	}
+	return defaultServicePort
+}
+
+func newTraefikService(name string, spec traefik.TraefikServiceSpec) traefik.TraefikService {
+	return traefik.TraefikService{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       traefikServiceKind,
+			APIVersion: apiVersionNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+func loadBalancerSpec(b backendRef) traefik.LoadBalancerSpec {
+	return traefik.LoadBalancerSpec{
+		Name: b.Name,
+		Port: intstr.FromInt(int(b.Port)),
+	}
+}
+
+// traefikBackend returns the service a route points at. A single backend is referenced
+// directly, weights and mirrors go through TraefikServices named after name.
+// transport and scheme apply to the backends, which are kubernetes Services
+func traefikBackend(name string, backends []backendRef, mirrors []mirrorRef, transport string, scheme string) (traefik.Service, []traefik.TraefikService) {
+	var services []traefik.TraefikService
+	backendSpec := func(b backendRef) traefik.LoadBalancerSpec {
+		spec := loadBalancerSpec(b)
+		spec.ServersTransport = transport
+		spec.Scheme = scheme
+		return spec
+	}
+	main := backendSpec(backends[0])
+
+	if len(backends) > 1 {
+		weightedName := name
+		if len(mirrors) > 0 {
+			weightedName = name + "-weighted"
+		}
+		weighted := &traefik.WeightedRoundRobin{}
+		for _, b := range backends {
+			s := traefik.Service{LoadBalancerSpec: backendSpec(b)}
+			s.Weight = utils.PointerTo(int(b.Weight))
+			weighted.Services = append(weighted.Services, s)
+		}
+		services = append(services, newTraefikService(weightedName, traefik.TraefikServiceSpec{Weighted: weighted}))
+		main = traefik.LoadBalancerSpec{Name: weightedName, Kind: traefikServiceKind}
+	}
+
+	if len(mirrors) > 0 {
+		mirroring := &traefik.Mirroring{LoadBalancerSpec: main}
+		for _, m := range mirrors {
+			mirroring.Mirrors = append(mirroring.Mirrors, traefik.MirrorService{
+				LoadBalancerSpec: loadBalancerSpec(m.backendRef),
+				Percent:          m.Percent,
+			})
+		}
+		services = append(services, newTraefikService(name, traefik.TraefikServiceSpec{Mirroring: mirroring}))
+		main = traefik.LoadBalancerSpec{Name: name, Kind: traefikServiceKind}
+	}
+	return traefik.Service{LoadBalancerSpec: main}, services
+}
+
+// clearTraefikServicePort drops the port of a reference to a TraefikService, which has none
+// but gets one marshalled as LoadBalancerSpec.Port is not a pointer
+func clearTraefikServicePort(ref *yaml.RNode) error {
+	if kind, _ := ref.GetString("kind"); kind != traefikServiceKind {
+		return nil
+	}
+	return ref.PipeE(yaml.Clear("port"))
+}
+
+// clearTraefikServicePorts clears the TraefikService references of an IngressRoute or TraefikService
+func clearTraefikServicePorts(node *yaml.RNode) error {
+	mirroring, err := node.Pipe(yaml.Lookup("spec", "mirroring"))
+	if err != nil {
+		return err
+	}
+	if mirroring != nil {
+		return clearTraefikServicePort(mirroring)
+	}
+	routes, err := node.Pipe(yaml.Lookup("spec", "routes"))
+	if err != nil || routes == nil {
+		return err
+	}
+	return routes.VisitElements(func(route *yaml.RNode) error {
+		services := route.Field("services")
+		if services == nil {
+			return nil
+		}
+		return services.Value.VisitElements(clearTraefikServicePort)
+	})
+}
+
+// retryPolicy retries requests the route's backends failed
+type retryPolicy struct {
+	Attempts int32 `json:"attempts"`
+	// PerTryTimeout bounds every attempt, a duration like 2s
+	PerTryTimeout string `json:"perTryTimeout,omitempty"`
+	// RetryOn are the failures that are retried, like 5xx or connect-failure
+	RetryOn []string `json:"retryOn,omitempty"`
+}
+
+// backendTLSConfig makes the proxy talk TLS to the route's backends
+type backendTLSConfig struct {
+	// ServerName is sent as SNI and verified against the backend certificate
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	// CASecrets verify self signed backend certificates
+	CASecrets []string `json:"caSecrets,omitempty"`
+}
+
+// validateTimeouts checks a route's timeout, retries and backend TLS
+func validateTimeouts(timeout string, retries *retryPolicy, backendTLS *backendTLSConfig) error {
+	if backendTLS != nil && backendTLS.InsecureSkipVerify && len(backendTLS.CASecrets) > 0 {
+		return fmt.Errorf("backendTLS.insecureSkipVerify can not be combined with caSecrets")
+	}
+	if timeout != "" && !durationPattern.MatchString(timeout) {
+		return fmt.Errorf("timeout %s is not a duration like 10s or 1m", timeout)
+	}
+	if retries == nil {
+		return nil
+	}
+	if retries.Attempts <= 0 {
+		return fmt.Errorf("retries.attempts has to be positive")
+	}
+	if retries.PerTryTimeout != "" && !durationPattern.MatchString(retries.PerTryTimeout) {
+		return fmt.Errorf("retries.perTryTimeout %s is not a duration like 2s", retries.PerTryTimeout)
+	}
+	return nil
+}
+
+// traefikServersTransport configures how Traefik connects to a route's backends,
+// nil when the route needs no timeout or backend TLS
+func traefikServersTransport(name string, r *httpRoute) *traefik.ServersTransport {
+	if r.Timeout == "" && r.BackendTLS == nil {
+		return nil
+	}
+	spec := traefik.ServersTransportSpec{}
+	if r.Timeout != "" {
+		// Traefik has no timeout for the whole request, the response headers are the closest
+		spec.ForwardingTimeouts = &traefik.ForwardingTimeouts{
+			ResponseHeaderTimeout: utils.PointerTo(intstr.FromString(r.Timeout)),
+		}
+	}
+	if r.BackendTLS != nil {
+		spec.ServerName = r.BackendTLS.ServerName
+		spec.InsecureSkipVerify = r.BackendTLS.InsecureSkipVerify
+		spec.RootCAsSecrets = r.BackendTLS.CASecrets
+	}
+	return &traefik.ServersTransport{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       serversTransportKind,
+			APIVersion: apiVersionNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+// traefikRetry retries a route's failed requests. Traefik retries on network errors only,
+// so neither retry conditions nor per try timeouts can be set
+func traefikRetry(name string, r *httpRoute) (*traefik.Middleware, error) {
+	if r.Retries == nil {
+		return nil, nil
+	}
+	if r.Retries.PerTryTimeout != "" || len(r.Retries.RetryOn) > 0 {
+		return nil, fmt.Errorf("traefik output does not support retries.perTryTimeout and retries.retryOn on route %s", r.Match.Rule)
+	}
+	m := newMiddleware(name, traefik.MiddlewareSpec{
+		Retry: &traefik.Retry{Attempts: int(r.Retries.Attempts)},
+	})
+	return &m, nil
+}
@@ -0,0 +1,191 @@
+package networking
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	cv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"golang.org/x/net/publicsuffix"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	apiVersionCertManager = "cert-manager.io/v1"
+	defaultIssuer         = "letsencrypt"
+	defaultStagingIssuer  = "letsencrypt-staging"
+)
+
+// certificateConfig configures how the hosts get their TLS certificates
+type certificateConfig struct {
+	Issuer *issuerConfig `json:"issuer,omitempty"`
+	// Wildcard requests *.<parent domain> instead of each host
+	Wildcard bool `json:"wildcard,omitempty"`
+	// Split issues a certificate per registered domain instead of one for all, to stay under
+	// SAN limits. Hosts under the same domain, like www.foo.com and api.foo.com, share one
+	Split bool `json:"split,omitempty"`
+	// SecretName reuses an existing TLS secret, no certificate is issued
+	SecretName string `json:"secretName,omitempty"`
+}
+
+type issuerConfig struct {
+	// Kind is ClusterIssuer or Issuer, ClusterIssuer when empty
+	Kind string `json:"kind,omitempty"`
+	// Name is letsencrypt when empty, or letsencrypt-staging for Staging
+	Name    string `json:"name,omitempty"`
+	Staging bool   `json:"staging,omitempty"`
+}
+
+// tlsCertificate is a TLS secret and the hosts it is used for. Name is the Certificate
+// that issues it, empty for an existing secret
+type tlsCertificate struct {
+	Name       string
+	SecretName string
+	DNSNames   []string
+	Hosts      []string
+}
+
+func certificateSecretName(name string) string {
+	return name + "-cert"
+}
+
+// wildcardName returns *.<parent domain> for host, or host when it has no parent below the TLD
+func wildcardName(host string) string {
+	if strings.HasPrefix(host, "*.") {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return host
+	}
+	return "*." + strings.Join(labels[1:], ".")
+}
+
+// registeredDomain returns the domain a dns name was registered under, the label below its
+// public suffix: foo.co.id for *.api.foo.co.id. A name without one is its own domain
+func registeredDomain(dnsName string) string {
+	host := strings.TrimPrefix(dnsName, "*.")
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// certificateSlug turns a domain into something that fits in a resource name
+func certificateSlug(domain string) string {
+	return strings.ReplaceAll(domain, ".", "-")
+}
+
+// planCertificates decides which TLS secrets cover the config's hosts
+func planCertificates(fn *networkingSpec) ([]tlsCertificate, error) {
+	conf := fn.Certificate
+	if conf == nil {
+		conf = &certificateConfig{}
+	}
+	if conf.SecretName != "" {
+		if conf.Issuer != nil || conf.Wildcard || conf.Split {
+			return nil, fmt.Errorf("certificate.secretName can not be combined with issuer, wildcard or split")
+		}
+		return []tlsCertificate{{SecretName: conf.SecretName, Hosts: makeCopy(fn.Hosts)}}, nil
+	}
+	if len(fn.Hosts) == 0 {
+		return nil, nil
+	}
+	if conf.Issuer != nil && conf.Issuer.Kind != "" && conf.Issuer.Kind != "ClusterIssuer" && conf.Issuer.Kind != "Issuer" {
+		return nil, fmt.Errorf("certificate.issuer.kind has to be ClusterIssuer or Issuer, got %s", conf.Issuer.Kind)
+	}
+
+	// hosts covered by the same dns name share it, in order of first use
+	var dnsNames []string
+	hostsByName := map[string][]string{}
+	for _, host := range fn.Hosts {
+		name := host
+		if conf.Wildcard {
+			name = wildcardName(host)
+		}
+		if _, ok := hostsByName[name]; !ok {
+			dnsNames = append(dnsNames, name)
+		}
+		hostsByName[name] = append(hostsByName[name], host)
+	}
+
+	if !conf.Split {
+		return []tlsCertificate{{
+			Name:       fn.App,
+			SecretName: certificateSecretName(fn.App),
+			DNSNames:   dnsNames,
+			Hosts:      makeCopy(fn.Hosts),
+		}}, nil
+	}
+	// dns names under the same registered domain share a certificate, in order of first use
+	var domains []string
+	certsByDomain := map[string]*tlsCertificate{}
+	for _, dnsName := range dnsNames {
+		domain := registeredDomain(dnsName)
+		cert, ok := certsByDomain[domain]
+		if !ok {
+			name := fmt.Sprintf("%s-%s", fn.App, certificateSlug(domain))
+			cert = &tlsCertificate{Name: name, SecretName: certificateSecretName(name)}
+			certsByDomain[domain] = cert
+			domains = append(domains, domain)
+		}
+		cert.DNSNames = append(cert.DNSNames, dnsName)
+		cert.Hosts = append(cert.Hosts, hostsByName[dnsName]...)
+	}
+	var certs []tlsCertificate
+	for _, domain := range domains {
+		certs = append(certs, *certsByDomain[domain])
+	}
+	return certs, nil
+}
+
+func issuerRef(conf *certificateConfig) cmmeta.ObjectReference {
+	ref := cmmeta.ObjectReference{Name: defaultIssuer, Kind: "ClusterIssuer"}
+	if conf == nil || conf.Issuer == nil {
+		return ref
+	}
+	if conf.Issuer.Kind != "" {
+		ref.Kind = conf.Issuer.Kind
+	}
+	switch {
+	case conf.Issuer.Name != "":
+		ref.Name = conf.Issuer.Name
+	case conf.Issuer.Staging:
+		ref.Name = defaultStagingIssuer
+	}
+	return ref
+}
+
+// generateCertificates renders a Certificate for every planned certificate that is issued
+func generateCertificates(fn *networkingSpec, certs []tlsCertificate) ([]*yaml.RNode, error) {
+	out := []*yaml.RNode{}
+	for _, c := range certs {
+		if c.Name == "" {
+			continue
+		}
+		certificate := cv1.Certificate{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Certificate",
+				APIVersion: apiVersionCertManager,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: c.Name,
+			},
+			Spec: cv1.CertificateSpec{
+				SecretName: c.SecretName,
+				DNSNames:   c.DNSNames,
+				IssuerRef:  issuerRef(fn.Certificate),
+			},
+		}
+
+		certificateNode, err := fnutils.MakeRNode(certificate)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, certificateNode)
+	}
+	return out, nil
+}
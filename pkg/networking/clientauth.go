@@ -0,0 +1,127 @@
+package networking
+
+import (
+	"fmt"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	cv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const tlsOptionKind = "TLSOption"
+
+// clientAuthConfig requires the clients of a route to present a certificate signed by a CA
+type clientAuthConfig struct {
+	// CASecret holds the CA bundle client certificates are verified against, in ca.crt
+	CASecret string `json:"caSecret"`
+	// Issuer generates CASecret as a cert-manager CA Certificate, typically from a
+	// self-signed issuer. The secret has to exist already when unset
+	Issuer *issuerConfig `json:"issuer,omitempty"`
+}
+
+func (c *clientAuthConfig) validate() error {
+	if c.CASecret == "" {
+		return fmt.Errorf("clientAuth.caSecret can not be empty")
+	}
+	if c.Issuer == nil {
+		return nil
+	}
+	if c.Issuer.Name == "" || c.Issuer.Staging {
+		return fmt.Errorf("clientAuth.issuer needs a name, the letsencrypt issuers can not issue a CA")
+	}
+	if c.Issuer.Kind != "" && c.Issuer.Kind != "ClusterIssuer" && c.Issuer.Kind != "Issuer" {
+		return fmt.Errorf("clientAuth.issuer.kind has to be ClusterIssuer or Issuer, got %s", c.Issuer.Kind)
+	}
+	return nil
+}
+
+// validateClientAuth checks that routes sharing a host agree on client auth. Traefik picks the
+// TLS options by SNI, before it knows the route, and falls back to the default ones when
+// the routers of a host disagree
+func validateClientAuth(routes []httpRoute) error {
+	caByHost := map[string]string{}
+	issuerByCA := map[string]*issuerConfig{}
+	for _, r := range routes {
+		ca := ""
+		if r.ClientAuth != nil {
+			ca = r.ClientAuth.CASecret
+			if issuer, ok := issuerByCA[ca]; ok && !sameIssuer(issuer, r.ClientAuth.Issuer) {
+				return fmt.Errorf("routes using clientAuth.caSecret %s have to use the same issuer", ca)
+			}
+			issuerByCA[ca] = r.ClientAuth.Issuer
+		}
+		for _, h := range r.Hosts {
+			other, ok := caByHost[h]
+			if ok && other != ca {
+				return fmt.Errorf("host %s has routes with different clientAuth, TLS options apply to the whole host", h)
+			}
+			caByHost[h] = ca
+		}
+	}
+	return nil
+}
+
+func sameIssuer(a, b *issuerConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func tlsOptionName(app string, ca string) string {
+	return fmt.Sprintf("%s-mtls-%s", app, ca)
+}
+
+func traefikTLSOption(name string, ca string) traefik.TLSOption {
+	return traefik.TLSOption{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       tlsOptionKind,
+			APIVersion: apiVersionNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: traefik.TLSOptionSpec{
+			ClientAuth: traefik.ClientAuth{
+				SecretNames:    []string{ca},
+				ClientAuthType: "RequireAndVerifyClientCert",
+			},
+		},
+	}
+}
+
+// generateCACertificates renders a CA Certificate for every CA secret a route wants issued
+func generateCACertificates(routes []httpRoute) ([]*yaml.RNode, error) {
+	out := []*yaml.RNode{}
+	generated := map[string]bool{}
+	for _, r := range routes {
+		if r.ClientAuth == nil || r.ClientAuth.Issuer == nil || generated[r.ClientAuth.CASecret] {
+			continue
+		}
+		ca := r.ClientAuth.CASecret
+		generated[ca] = true
+		certificate := cv1.Certificate{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Certificate",
+				APIVersion: apiVersionCertManager,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ca,
+			},
+			Spec: cv1.CertificateSpec{
+				IsCA:       true,
+				CommonName: ca,
+				SecretName: ca,
+				IssuerRef:  issuerRef(&certificateConfig{Issuer: r.ClientAuth.Issuer}),
+			},
+		}
+		node, err := fnutils.MakeRNode(certificate)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
@@ -0,0 +1,157 @@
+package networking
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"github.com/bukukasio/krm-functions/pkg/networking/thirdparty"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	apiVersionExternalDNS = "externaldns.k8s.io/v1alpha1"
+	// dns modes
+	dnsModeEndpoint    = "endpoint"
+	dnsModeAnnotations = "annotations"
+
+	externalDNSTargetAnnotation = "external-dns.alpha.kubernetes.io/target"
+	externalDNSTTLAnnotation    = "external-dns.alpha.kubernetes.io/ttl"
+)
+
+// dnsConfig publishes the config's hosts through external-dns
+type dnsConfig struct {
+	// Mode is endpoint for a DNSEndpoint with a record per host, or annotations for
+	// external-dns annotations on the generated routes. endpoint when empty
+	Mode string `json:"mode,omitempty"`
+	// Targets are the ingress load balancer's IPs, or a single hostname
+	Targets []string `json:"targets"`
+	// RecordType is A, AAAA or CNAME, derived from the targets when empty
+	RecordType string `json:"recordType,omitempty"`
+	// TTL in seconds, the provider's default when empty
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// dnsRecordType is the record type the targets need, as external-dns infers it
+func dnsRecordType(targets []string) string {
+	recordType := "CNAME"
+	for i, t := range targets {
+		ip := net.ParseIP(t)
+		targetType := "CNAME"
+		switch {
+		case ip != nil && ip.To4() != nil:
+			targetType = "A"
+		case ip != nil:
+			targetType = "AAAA"
+		}
+		if i == 0 {
+			recordType = targetType
+		} else if targetType != recordType {
+			return ""
+		}
+	}
+	return recordType
+}
+
+func validateDNS(fn *networkingSpec) error {
+	conf := fn.DNS
+	switch conf.Mode {
+	case dnsModeEndpoint:
+	case dnsModeAnnotations:
+		// only the traefik and ingress sources of external-dns read the route's hosts
+		if fn.Output != outputTraefik && fn.Output != outputIngress {
+			return fmt.Errorf("%s output only supports dns mode %s", fn.Output, dnsModeEndpoint)
+		}
+	default:
+		return fmt.Errorf("dns mode has to be %s or %s, got %s", dnsModeEndpoint, dnsModeAnnotations, conf.Mode)
+	}
+	if len(conf.Targets) == 0 {
+		return fmt.Errorf("dns needs targets")
+	}
+	if conf.TTL < 0 {
+		return fmt.Errorf("dns ttl can not be negative")
+	}
+	inferred := dnsRecordType(conf.Targets)
+	if inferred == "" {
+		return fmt.Errorf("dns targets %s mix IPs and hostnames", strings.Join(conf.Targets, ", "))
+	}
+	if inferred == "CNAME" && len(conf.Targets) > 1 {
+		return fmt.Errorf("dns targets can only be a single hostname")
+	}
+	if conf.RecordType == "" {
+		return nil
+	}
+	switch conf.RecordType {
+	case "A", "AAAA", "CNAME":
+	default:
+		return fmt.Errorf("dns recordType has to be A, AAAA or CNAME, got %s", conf.RecordType)
+	}
+	if conf.RecordType != inferred {
+		return fmt.Errorf("dns recordType %s does not fit targets %s", conf.RecordType, strings.Join(conf.Targets, ", "))
+	}
+	return nil
+}
+
+// generateDNS renders a DNSEndpoint for the config's hosts, or in annotations mode annotates
+// the routes that serve them and renders nothing
+func generateDNS(fn *networkingSpec, routes []*yaml.RNode) ([]*yaml.RNode, error) {
+	conf := fn.DNS
+	if conf == nil {
+		return nil, nil
+	}
+	if err := validateDNS(fn); err != nil {
+		return nil, fieldError("spec.dns", err)
+	}
+
+	if conf.Mode == dnsModeAnnotations {
+		annotations := map[string]string{externalDNSTargetAnnotation: strings.Join(conf.Targets, ",")}
+		if conf.TTL > 0 {
+			annotations[externalDNSTTLAnnotation] = strconv.FormatInt(conf.TTL, 10)
+		}
+		for _, node := range routes {
+			// the internal grpc host stays out of public dns
+			if node.GetName() == fmt.Sprintf("%s-grpc", fn.App) {
+				continue
+			}
+			if kind := node.GetKind(); kind != ingressRouteKind && kind != "Ingress" {
+				continue
+			}
+			for _, k := range sortedKeys(annotations) {
+				if err := node.PipeE(yaml.SetAnnotation(k, annotations[k])); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	recordType := conf.RecordType
+	if recordType == "" {
+		recordType = dnsRecordType(conf.Targets)
+	}
+	endpoint := thirdparty.DNSEndpoint{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DNSEndpoint",
+			APIVersion: apiVersionExternalDNS,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fn.App,
+		},
+	}
+	for _, host := range fn.Hosts {
+		endpoint.Spec.Endpoints = append(endpoint.Spec.Endpoints, thirdparty.Endpoint{
+			DNSName:    host,
+			Targets:    makeCopy(conf.Targets),
+			RecordType: recordType,
+			RecordTTL:  conf.TTL,
+		})
+	}
+	node, err := fnutils.MakeRNode(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return []*yaml.RNode{node}, nil
+}
@@ -0,0 +1,283 @@
+package networking
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	"github.com/bukukasio/krm-functions/pkg/networking/thirdparty"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const apiVersionGateway = "gateway.networking.k8s.io/v1alpha2"
+
+// gatewayConfig is the Gateway that generated routes attach to
+type gatewayConfig struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	SectionName string `json:"sectionName,omitempty"`
+	// Vpn is the parent for vpn only routes, usually an internal Gateway or listener
+	Vpn *gatewayConfig `json:"vpn,omitempty"`
+}
+
+func (g *gatewayConfig) parentRef() gatewayv1alpha2.ParentRef {
+	ref := gatewayv1alpha2.ParentRef{
+		Name: gatewayv1alpha2.ObjectName(g.Name),
+	}
+	if g.Namespace != "" {
+		ref.Namespace = utils.PointerTo(gatewayv1alpha2.Namespace(g.Namespace))
+	}
+	if g.SectionName != "" {
+		ref.SectionName = utils.PointerTo(gatewayv1alpha2.SectionName(g.SectionName))
+	}
+	return ref
+}
+
+// httpRouteMatches translates a route matcher into HTTPRoute matches. A match has a single
+// method, so a route with several methods becomes one match per method
+func httpRouteMatches(m matcher) ([]gatewayv1alpha2.HTTPRouteMatch, error) {
+	if m.Typed == nil {
+		return nil, fmt.Errorf("gateway-api output can not express match %s, use the typed match fields", m.Rule)
+	}
+	match := gatewayv1alpha2.HTTPRouteMatch{}
+	if m.Typed.Path != "" {
+		match.Path = &gatewayv1alpha2.HTTPPathMatch{
+			Type:  utils.PointerTo(gatewayv1alpha2.PathMatchExact),
+			Value: utils.PointerTo(m.Typed.Path),
+		}
+	}
+	if m.Typed.PathPrefix != "" {
+		match.Path = &gatewayv1alpha2.HTTPPathMatch{
+			Type:  utils.PointerTo(gatewayv1alpha2.PathMatchPathPrefix),
+			Value: utils.PointerTo(m.Typed.PathPrefix),
+		}
+	}
+	for _, k := range sortedKeys(m.Typed.Headers) {
+		match.Headers = append(match.Headers, gatewayv1alpha2.HTTPHeaderMatch{
+			Type:  utils.PointerTo(gatewayv1alpha2.HeaderMatchExact),
+			Name:  gatewayv1alpha2.HTTPHeaderName(k),
+			Value: m.Typed.Headers[k],
+		})
+	}
+	for _, k := range sortedKeys(m.Typed.Query) {
+		match.QueryParams = append(match.QueryParams, gatewayv1alpha2.HTTPQueryParamMatch{
+			Type:  utils.PointerTo(gatewayv1alpha2.QueryParamMatchExact),
+			Name:  k,
+			Value: m.Typed.Query[k],
+		})
+	}
+
+	if len(m.Typed.Methods) == 0 {
+		return []gatewayv1alpha2.HTTPRouteMatch{match}, nil
+	}
+	matches := []gatewayv1alpha2.HTTPRouteMatch{}
+	for _, method := range m.Typed.Methods {
+		methodMatch := match
+		methodMatch.Method = utils.PointerTo(gatewayv1alpha2.HTTPMethod(method))
+		matches = append(matches, methodMatch)
+	}
+	return matches, nil
+}
+
+func grpcRouteMatches(methods []grpcMethod) []thirdparty.GRPCRouteMatch {
+	var matches []thirdparty.GRPCRouteMatch
+	for _, m := range methods {
+		match := &thirdparty.GRPCMethodMatch{
+			Type:    utils.PointerTo("Exact"),
+			Service: utils.PointerTo(m.Service),
+		}
+		if m.Method != "" {
+			match.Method = utils.PointerTo(m.Method)
+		}
+		matches = append(matches, thirdparty.GRPCRouteMatch{Method: match})
+	}
+	return matches
+}
+
+func backendRefFor(b backendRef) gatewayv1alpha2.BackendRef {
+	return gatewayv1alpha2.BackendRef{
+		BackendObjectReference: gatewayv1alpha2.BackendObjectReference{
+			Name: gatewayv1alpha2.ObjectName(b.Name),
+			Port: utils.PointerTo(gatewayv1alpha2.PortNumber(b.Port)),
+		},
+	}
+}
+
+func hostnames(hosts []string) []gatewayv1alpha2.Hostname {
+	out := []gatewayv1alpha2.Hostname{}
+	for _, h := range hosts {
+		out = append(out, gatewayv1alpha2.Hostname(h))
+	}
+	return out
+}
+
+func newHTTPRoute(name string, parent *gatewayConfig) gatewayv1alpha2.HTTPRoute {
+	return gatewayv1alpha2.HTTPRoute{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "HTTPRoute",
+			APIVersion: apiVersionGateway,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: gatewayv1alpha2.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1alpha2.CommonRouteSpec{
+				ParentRefs: []gatewayv1alpha2.ParentRef{parent.parentRef()},
+			},
+		},
+	}
+}
+
+// renderGatewayAPI renders the route model as Gateway API HTTPRoutes and GRPCRoutes.
+// Every route gets its own rule, vpn routes go to a separate HTTPRoute on the vpn parent
+func renderGatewayAPI(model *routeModel, gateway *gatewayConfig) ([]*yaml.RNode, error) {
+	if gateway == nil || gateway.Name == "" {
+		return nil, fmt.Errorf("gateway-api output needs gateway.name")
+	}
+
+	// hostnames belong to a whole HTTPRoute, so routes are grouped by vpn and host set,
+	// the first group of each keeps the plain name
+	var httpRoutes []*gatewayv1alpha2.HTTPRoute
+	groups := map[string]*gatewayv1alpha2.HTTPRoute{}
+	groupCount := map[string]int{}
+
+	for _, r := range model.HTTP {
+		matches, err := httpRouteMatches(r.Match)
+		if err != nil {
+			return nil, err
+		}
+		if unsupported := r.Policies.unsupported("requestHeaders"); len(unsupported) > 0 {
+			return nil, fmt.Errorf("gateway-api output does not support %s on route %s", strings.Join(unsupported, ", "), r.Match.Rule)
+		}
+		if r.hasTransport() {
+			return nil, fmt.Errorf("gateway-api output does not support timeout, retries and backendTLS on route %s", r.Match.Rule)
+		}
+		if r.Priority != 0 {
+			return nil, fmt.Errorf("gateway-api output does not support priority on route %s", r.Match.Rule)
+		}
+		if r.ClientAuth != nil {
+			return nil, fmt.Errorf("gateway-api output does not support clientAuth on route %s", r.Match.Rule)
+		}
+		rule := gatewayv1alpha2.HTTPRouteRule{Matches: matches}
+		for _, b := range r.Backends {
+			ref := backendRefFor(b)
+			if len(r.Backends) > 1 {
+				ref.Weight = utils.PointerTo(b.Weight)
+			}
+			rule.BackendRefs = append(rule.BackendRefs, gatewayv1alpha2.HTTPBackendRef{BackendRef: ref})
+		}
+		for _, m := range r.Mirrors {
+			// the v1alpha2 RequestMirror filter copies every request
+			if m.Percent != 100 {
+				return nil, fmt.Errorf("gateway-api output can only mirror 100 percent of route %s to %s", r.Match.Rule, m.Name)
+			}
+			rule.Filters = append(rule.Filters, gatewayv1alpha2.HTTPRouteFilter{
+				Type: gatewayv1alpha2.HTTPRouteFilterRequestMirror,
+				RequestMirror: &gatewayv1alpha2.HTTPRequestMirrorFilter{
+					BackendRef: backendRefFor(m.backendRef).BackendObjectReference,
+				},
+			})
+		}
+		if len(r.Policies.RequestHeaders) > 0 {
+			rule.Filters = append(rule.Filters, requestHeaderFilter(r.Policies.RequestHeaders))
+		}
+
+		parent, suffix := gateway, "http"
+		if r.Allowlist != nil {
+			if !r.Allowlist.Default {
+				return nil, fmt.Errorf("gateway-api output only supports the default network profile, route %s uses %s", r.Match.Rule, r.Allowlist.Profile)
+			}
+			if gateway.Vpn == nil || gateway.Vpn.Name == "" {
+				return nil, fmt.Errorf("vpn route %s needs gateway.vpn to be set for gateway-api output", r.Match.Rule)
+			}
+			parent, suffix = gateway.Vpn, "vpn"
+		}
+
+		key := suffix + "/" + strings.Join(sortedCopy(r.Hosts), ",")
+		route, ok := groups[key]
+		if !ok {
+			name := fmt.Sprintf("%s-%s", model.App, suffix)
+			if n := groupCount[suffix]; n > 0 {
+				name = fmt.Sprintf("%s-%d", name, n)
+			}
+			groupCount[suffix]++
+			route = utils.PointerTo(newHTTPRoute(name, parent))
+			route.Spec.Hostnames = hostnames(r.Hosts)
+			groups[key] = route
+			httpRoutes = append(httpRoutes, route)
+		}
+		route.Spec.Rules = append(route.Spec.Rules, rule)
+	}
+
+	routes := []any{}
+	for _, r := range httpRoutes {
+		routes = append(routes, *r)
+	}
+
+	if model.GRPC != nil {
+		// the gateway terminates TLS for the external hosts, so they share the route
+		grpcHosts := []string{model.GRPC.Host}
+		for _, e := range model.GRPC.External {
+			grpcHosts = append(grpcHosts, e.Hosts...)
+		}
+		routes = append(routes, thirdparty.GRPCRoute{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "GRPCRoute",
+				APIVersion: apiVersionGateway,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-grpc", model.App),
+			},
+			Spec: thirdparty.GRPCRouteSpec{
+				CommonRouteSpec: gatewayv1alpha2.CommonRouteSpec{
+					ParentRefs: []gatewayv1alpha2.ParentRef{gateway.parentRef()},
+				},
+				Hostnames: hostnames(grpcHosts),
+				Rules: []thirdparty.GRPCRouteRule{
+					{
+						Matches:     grpcRouteMatches(model.GRPC.Methods),
+						BackendRefs: []gatewayv1alpha2.BackendRef{backendRefFor(model.GRPC.Backend)},
+					},
+				},
+			},
+		})
+	}
+
+	out := []*yaml.RNode{}
+	for _, r := range routes {
+		node, err := fnutils.MakeRNode(r)
+		if err != nil {
+			return nil, err
+		}
+		// route status is owned by the gateway controller
+		if err := node.PipeE(yaml.Clear("status")); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
+
+func requestHeaderFilter(headers map[string]string) gatewayv1alpha2.HTTPRouteFilter {
+	modifier := &gatewayv1alpha2.HTTPRequestHeaderFilter{}
+	for _, k := range sortedKeys(headers) {
+		modifier.Set = append(modifier.Set, gatewayv1alpha2.HTTPHeader{
+			Name:  gatewayv1alpha2.HTTPHeaderName(k),
+			Value: headers[k],
+		})
+	}
+	return gatewayv1alpha2.HTTPRouteFilter{
+		Type:                  gatewayv1alpha2.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: modifier,
+	}
+}
+
+func sortedCopy(in []string) []string {
+	out := makeCopy(in)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,119 @@
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultInternalDomain is the cluster internal domain grpc is served on when the config sets none
+const defaultInternalDomain = "internal.bukukas.k8s"
+
+// grpcConfig is the config's grpc block. `grpc: true` still enables it with the defaults
+type grpcConfig struct {
+	Enabled bool `json:"-"`
+	// InternalDomain is the suffix of the internal host <app>.<internalDomain>
+	InternalDomain string `json:"internalDomain,omitempty"`
+	// Hosts expose grpc externally over TLS, they have to be declared in the config's hosts
+	Hosts []string `json:"hosts,omitempty"`
+	// Methods restrict grpc to /package.Service/Method, or /package.Service/ for a whole service
+	Methods []string `json:"methods,omitempty"`
+}
+
+func (g *grpcConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*g = grpcConfig{Enabled: enabled}
+		return nil
+	}
+	// the alias has no UnmarshalJSON, so this does not recurse
+	type config grpcConfig
+	c := config{}
+	if err := decodeStrict(data, &c); err != nil {
+		return err
+	}
+	*g = grpcConfig(c)
+	g.Enabled = true
+	return nil
+}
+
+func (g grpcConfig) MarshalJSON() ([]byte, error) {
+	if g.InternalDomain == "" && len(g.Hosts) == 0 && len(g.Methods) == 0 {
+		return json.Marshal(g.Enabled)
+	}
+	type config grpcConfig
+	return json.Marshal(config(g))
+}
+
+// grpcMethodPattern is a grpc request path, /package.Service/Method or /package.Service/
+var grpcMethodPattern = regexp.MustCompile(`^/[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*/([A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// grpcMethod is a parsed grpc method match, Method is empty for a whole service
+type grpcMethod struct {
+	Service string
+	Method  string
+}
+
+// path is the request path of the method, a prefix for a whole service
+func (m grpcMethod) path() string {
+	return fmt.Sprintf("/%s/%s", m.Service, m.Method)
+}
+
+func parseGRPCMethod(path string) (grpcMethod, error) {
+	if !grpcMethodPattern.MatchString(path) {
+		return grpcMethod{}, fmt.Errorf("grpc method %s has to look like /package.Service/Method or /package.Service/", path)
+	}
+	service, method, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return grpcMethod{Service: service, Method: method}, nil
+}
+
+// grpcExternal are external grpc hosts that share a TLS secret
+type grpcExternal struct {
+	Hosts     []string
+	TLSSecret string
+}
+
+// buildGRPCRoute resolves the grpc block against the config's hosts and certificates
+func buildGRPCRoute(fn *networkingSpec, backend backendRef, certificates []tlsCertificate) (*grpcRoute, error) {
+	route := &grpcRoute{
+		Host:    fmt.Sprintf("%s.%s", fn.App, strings.Trim(fn.Grpc.InternalDomain, ".")),
+		Backend: backend,
+	}
+	for _, path := range fn.Grpc.Methods {
+		m, err := parseGRPCMethod(path)
+		if err != nil {
+			return nil, err
+		}
+		route.Methods = append(route.Methods, m)
+	}
+	if len(fn.Grpc.Hosts) == 0 {
+		return route, nil
+	}
+	hosts, err := routeHosts(fn.Hosts, fn.Grpc.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	// an IngressRoute has a single TLS secret, so hosts are grouped by the certificate covering them
+	bySecret := map[string]int{}
+	for _, host := range hosts {
+		for _, c := range certificates {
+			covered := false
+			for _, h := range c.Hosts {
+				covered = covered || h == host
+			}
+			if !covered {
+				continue
+			}
+			i, ok := bySecret[c.SecretName]
+			if !ok {
+				i = len(route.External)
+				bySecret[c.SecretName] = i
+				route.External = append(route.External, grpcExternal{TLSSecret: c.SecretName})
+			}
+			route.External[i].Hosts = append(route.External[i].Hosts, host)
+			break
+		}
+	}
+	return route, nil
+}
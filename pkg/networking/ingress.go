@@ -0,0 +1,266 @@
+package networking
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const defaultIngressClass = "nginx"
+
+// ingressConfig configures the plain networking.k8s.io/v1 Ingress output
+type ingressConfig struct {
+	// ClassName is the ingressClassName, nginx when empty
+	ClassName string `json:"className,omitempty"`
+	// VpnSourceRanges are the CIDRs vpn routes are restricted to while no networkProfiles are declared
+	VpnSourceRanges []string `json:"vpnSourceRanges,omitempty"`
+}
+
+// ingressClassAnnotations are the annotations an ingress controller reads
+// for the features Ingress has no field for
+type ingressClassAnnotations struct {
+	Allowlist       string
+	BackendProtocol string
+	Grpc            string
+}
+
+var ingressClasses = map[string]ingressClassAnnotations{
+	"nginx": {
+		Allowlist:       "nginx.ingress.kubernetes.io/whitelist-source-range",
+		BackendProtocol: "nginx.ingress.kubernetes.io/backend-protocol",
+		Grpc:            "GRPC",
+	},
+}
+
+func newIngress(name string, className string, hosts []string, certificates []tlsCertificate) networkingv1.Ingress {
+	ingress := networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Ingress",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: utils.PointerTo(className),
+		},
+	}
+	for _, c := range certificates {
+		var covered []string
+		for _, h := range c.Hosts {
+			for _, host := range hosts {
+				if h == host {
+					covered = append(covered, h)
+				}
+			}
+		}
+		if len(covered) > 0 {
+			ingress.Spec.TLS = append(ingress.Spec.TLS, networkingv1.IngressTLS{
+				Hosts:      covered,
+				SecretName: c.SecretName,
+			})
+		}
+	}
+	return ingress
+}
+
+func ingressBackend(b backendRef) networkingv1.IngressBackend {
+	return networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{
+			Name: b.Name,
+			Port: networkingv1.ServiceBackendPort{Number: b.Port},
+		},
+	}
+}
+
+// ingressPath translates a route matcher into an Ingress path, which can only match on the path
+func ingressPath(m matcher) (networkingv1.HTTPIngressPath, error) {
+	t := m.Typed
+	if t == nil || len(t.Headers) > 0 || len(t.Methods) > 0 || len(t.Query) > 0 {
+		return networkingv1.HTTPIngressPath{}, fmt.Errorf("ingress output can only match on path or pathPrefix, got %s", m.Rule)
+	}
+	if t.Path != "" {
+		return networkingv1.HTTPIngressPath{
+			Path:     t.Path,
+			PathType: utils.PointerTo(networkingv1.PathTypeExact),
+		}, nil
+	}
+	if t.PathPrefix != "" {
+		return networkingv1.HTTPIngressPath{
+			Path:     t.PathPrefix,
+			PathType: utils.PointerTo(networkingv1.PathTypePrefix),
+		}, nil
+	}
+	return networkingv1.HTTPIngressPath{}, fmt.Errorf("ingress output needs a path or pathPrefix, got %s", m.Rule)
+}
+
+// grpcIngressPaths are the paths of the grpc methods, all of them when none are listed
+func grpcIngressPaths(g *grpcRoute) []networkingv1.HTTPIngressPath {
+	if len(g.Methods) == 0 {
+		return []networkingv1.HTTPIngressPath{{
+			Path:     "/",
+			PathType: utils.PointerTo(networkingv1.PathTypePrefix),
+			Backend:  ingressBackend(g.Backend),
+		}}
+	}
+	var paths []networkingv1.HTTPIngressPath
+	for _, m := range g.Methods {
+		pathType := networkingv1.PathTypeExact
+		if m.Method == "" {
+			pathType = networkingv1.PathTypePrefix
+		}
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     m.path(),
+			PathType: utils.PointerTo(pathType),
+			Backend:  ingressBackend(g.Backend),
+		})
+	}
+	return paths
+}
+
+// addRule adds path to the rule of every host, keeping host order stable. Without hosts the
+// path goes to a rule without host, which matches any host
+func addRule(ingress *networkingv1.Ingress, hosts []string, path networkingv1.HTTPIngressPath) {
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	for _, host := range hosts {
+		var rule *networkingv1.IngressRule
+		for i := range ingress.Spec.Rules {
+			if ingress.Spec.Rules[i].Host == host {
+				rule = &ingress.Spec.Rules[i]
+			}
+		}
+		if rule == nil {
+			ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{},
+				},
+			})
+			rule = &ingress.Spec.Rules[len(ingress.Spec.Rules)-1]
+		}
+		rule.HTTP.Paths = append(rule.HTTP.Paths, path)
+	}
+}
+
+// renderIngress renders the route model as Ingresses. Annotations apply to a whole Ingress,
+// so vpn routes of each network profile and grpc get their own Ingress next to the public one
+func renderIngress(model *routeModel, conf *ingressConfig) ([]*yaml.RNode, error) {
+	if conf == nil {
+		conf = &ingressConfig{}
+	}
+	className := conf.ClassName
+	if className == "" {
+		className = defaultIngressClass
+	}
+	annotations, knownClass := ingressClasses[className]
+
+	public := newIngress(fmt.Sprintf("%s-http", model.App), className, model.Hosts, model.TLS)
+	// allowlisted routes get an Ingress per network profile, in order of first use
+	var restricted []*networkingv1.Ingress
+	byProfile := map[string]*networkingv1.Ingress{}
+
+	for _, r := range model.HTTP {
+		if policies := r.Policies.names(); len(policies) > 0 {
+			return nil, fmt.Errorf("ingress output does not support %s on route %s", strings.Join(policies, ", "), r.Match.Rule)
+		}
+		if r.hasTransport() {
+			return nil, fmt.Errorf("ingress output does not support timeout, retries and backendTLS on route %s", r.Match.Rule)
+		}
+		if r.Priority != 0 {
+			return nil, fmt.Errorf("ingress output does not support priority on route %s", r.Match.Rule)
+		}
+		if r.ClientAuth != nil {
+			return nil, fmt.Errorf("ingress output does not support clientAuth on route %s", r.Match.Rule)
+		}
+		path, err := ingressPath(r.Match)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Backends) > 1 || len(r.Mirrors) > 0 {
+			return nil, fmt.Errorf("ingress output can not split or mirror route %s", r.Match.Rule)
+		}
+		path.Backend = ingressBackend(r.Backends[0])
+
+		ingress := &public
+		if r.Allowlist != nil {
+			if !knownClass {
+				return nil, fmt.Errorf("vpn routes are not supported for ingress class %s", className)
+			}
+			ingress = byProfile[r.Allowlist.Profile]
+			if ingress == nil {
+				// without network profiles the default one falls back to ingress.vpnSourceRanges
+				ranges := r.Allowlist.SourceRanges
+				if ranges == nil {
+					ranges = conf.VpnSourceRanges
+				}
+				if len(ranges) == 0 {
+					return nil, fmt.Errorf("vpn route %s needs networkProfiles or ingress.vpnSourceRanges", r.Match.Rule)
+				}
+				name := fmt.Sprintf("%s-vpn", model.App)
+				if !r.Allowlist.Default {
+					name = fmt.Sprintf("%s-vpn-%s", model.App, r.Allowlist.Profile)
+				}
+				ingress = utils.PointerTo(newIngress(name, className, model.Hosts, model.TLS))
+				ingress.Annotations[annotations.Allowlist] = strings.Join(ranges, ",")
+				byProfile[r.Allowlist.Profile] = ingress
+				restricted = append(restricted, ingress)
+			}
+		}
+		addRule(ingress, r.Hosts, path)
+	}
+
+	ingresses := []networkingv1.Ingress{public}
+	for _, ingress := range restricted {
+		ingresses = append(ingresses, *ingress)
+	}
+
+	if model.GRPC != nil {
+		if !knownClass {
+			return nil, fmt.Errorf("grpc is not supported for ingress class %s", className)
+		}
+		// the grpc host is cluster internal, so the certificate does not cover it
+		grpc := newIngress(fmt.Sprintf("%s-grpc", model.App), className, []string{model.GRPC.Host}, nil)
+		grpc.Annotations[annotations.BackendProtocol] = annotations.Grpc
+		for _, path := range grpcIngressPaths(model.GRPC) {
+			addRule(&grpc, []string{model.GRPC.Host}, path)
+		}
+		ingresses = append(ingresses, grpc)
+
+		var externalHosts []string
+		for _, e := range model.GRPC.External {
+			externalHosts = append(externalHosts, e.Hosts...)
+		}
+		if len(externalHosts) > 0 {
+			external := newIngress(fmt.Sprintf("%s-grpc-external", model.App), className, externalHosts, model.TLS)
+			external.Annotations[annotations.BackendProtocol] = annotations.Grpc
+			for _, path := range grpcIngressPaths(model.GRPC) {
+				addRule(&external, externalHosts, path)
+			}
+			ingresses = append(ingresses, external)
+		}
+	}
+
+	out := []*yaml.RNode{}
+	for _, ingress := range ingresses {
+		if len(ingress.Annotations) == 0 {
+			ingress.Annotations = nil
+		}
+		node, err := fnutils.MakeRNode(ingress)
+		if err != nil {
+			return nil, err
+		}
+		if err := node.PipeE(yaml.Clear("status")); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
@@ -0,0 +1,141 @@
+package networking
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"github.com/bukukasio/krm-functions/pkg/networking/thirdparty"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	apiVersionComputeCNRM = "compute.cnrm.cloud.google.com/v1beta1"
+
+	gkeLoadBalancerTypeAnnotation = "networking.gke.io/load-balancer-type"
+	gkeGlobalAccessAnnotation     = "networking.gke.io/internal-load-balancer-allow-global-access"
+)
+
+// internalConfig exposes ports of the app to the VPC through a GCP internal load balancer
+type internalConfig struct {
+	// Ports are the names of the app Service's ports the load balancer exposes
+	Ports []string `json:"ports"`
+	// SourceRanges are the CIDRs allowed to connect, the firewall rules GKE creates allow
+	// the whole VPC when empty
+	SourceRanges []string `json:"sourceRanges,omitempty"`
+	// GlobalAccess allows clients from all regions of the VPC, only the load balancer's when false
+	GlobalAccess bool `json:"globalAccess,omitempty"`
+	// StaticIP reserves the load balancer's IP, an ephemeral one is used when unset
+	StaticIP *staticIPConfig `json:"staticIP,omitempty"`
+}
+
+// staticIPConfig reserves an internal IP with a config-connector ComputeAddress
+type staticIPConfig struct {
+	// Address is the IP to reserve, it has to be free in the subnetwork
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	// Subnetwork is the subnetwork's self link or projects/<project>/regions/<region>/subnetworks/<name>
+	Subnetwork string `json:"subnetwork"`
+}
+
+func validateInternal(conf *internalConfig, svc corev1.Service) error {
+	if len(conf.Ports) == 0 {
+		return fmt.Errorf("internal needs ports")
+	}
+	seen := map[string]bool{}
+	for _, name := range conf.Ports {
+		if servicePort(svc, name) == 0 {
+			return fmt.Errorf("internal port %s is not a port of Service %s", name, svc.Name)
+		}
+		if seen[name] {
+			return fmt.Errorf("internal port %s is listed twice", name)
+		}
+		seen[name] = true
+	}
+	for _, r := range conf.SourceRanges {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			return fmt.Errorf("internal source range %s is not a CIDR", r)
+		}
+	}
+	if ip := conf.StaticIP; ip != nil {
+		if net.ParseIP(ip.Address) == nil {
+			return fmt.Errorf("internal staticIP.address %s is not an IP", ip.Address)
+		}
+		if ip.Region == "" || ip.Subnetwork == "" {
+			return fmt.Errorf("internal staticIP needs region and subnetwork")
+		}
+	}
+	return nil
+}
+
+// generateInternal renders the internal load balancer Service <app>-internal for some ports of
+// the app's Service, and the ComputeAddress that reserves its IP
+func generateInternal(fn *networkingSpec, svc corev1.Service) ([]*yaml.RNode, error) {
+	conf := fn.Internal
+	if conf == nil {
+		return nil, nil
+	}
+	if err := validateInternal(conf, svc); err != nil {
+		return nil, fieldError("spec.internal", err)
+	}
+
+	name := fmt.Sprintf("%s-internal", fn.App)
+	internal := corev1.Service{
+		TypeMeta: svc.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				gkeLoadBalancerTypeAnnotation: "Internal",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     corev1.ServiceTypeLoadBalancer,
+			Selector:                 svc.Spec.Selector,
+			LoadBalancerSourceRanges: conf.SourceRanges,
+		},
+	}
+	if conf.GlobalAccess {
+		internal.Annotations[gkeGlobalAccessAnnotation] = "true"
+	}
+	for _, portName := range conf.Ports {
+		for _, p := range svc.Spec.Ports {
+			if p.Name == portName {
+				internal.Spec.Ports = append(internal.Spec.Ports, p)
+			}
+		}
+	}
+
+	var out []*yaml.RNode
+	if ip := conf.StaticIP; ip != nil {
+		internal.Spec.LoadBalancerIP = ip.Address
+		address := thirdparty.ComputeAddress{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ComputeAddress",
+				APIVersion: apiVersionComputeCNRM,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: thirdparty.ComputeAddressSpec{
+				Address:       ip.Address,
+				AddressType:   "INTERNAL",
+				Description:   fmt.Sprintf("internal load balancer of %s", fn.App),
+				Location:      ip.Region,
+				SubnetworkRef: &thirdparty.ComputeResourceRef{External: ip.Subnetwork},
+			},
+		}
+		node, err := fnutils.MakeRNode(address)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+
+	node, err := fnutils.MakeRNode(internal)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*yaml.RNode{node}, out...), nil
+}
@@ -0,0 +1,420 @@
+package networking
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	"github.com/bukukasio/krm-functions/pkg/networking/thirdparty"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	apiVersionIstioNetworking = "networking.istio.io/v1beta1"
+	apiVersionIstioSecurity   = "security.istio.io/v1beta1"
+)
+
+// istioConfig is the Gateway that generated VirtualServices bind to
+type istioConfig struct {
+	// Gateway is an existing <namespace>/<name> Gateway, a Gateway for the app is generated when empty
+	Gateway string `json:"gateway,omitempty"`
+	// Selector picks the gateway pods of the generated Gateway, istio: ingressgateway when empty
+	Selector map[string]string `json:"selector,omitempty"`
+}
+
+// istioDuration converts a duration like 1m into the seconds protobuf durations are written in
+func istioDuration(d string) string {
+	parsed, err := time.ParseDuration(d)
+	if err != nil {
+		// validated with the route, so this is never hit
+		return d
+	}
+	return strconv.FormatFloat(parsed.Seconds(), 'f', -1, 64) + "s"
+}
+
+// istioWeights turns relative backend weights into the percentages a VirtualService needs,
+// handing the rounding remainder to the backends with the largest fractions
+func istioWeights(backends []backendRef) []int32 {
+	total := int32(0)
+	for _, b := range backends {
+		total += b.Weight
+	}
+	weights := make([]int32, len(backends))
+	remainders := make([]int32, len(backends))
+	assigned := int32(0)
+	for i, b := range backends {
+		weights[i] = b.Weight * 100 / total
+		remainders[i] = b.Weight * 100 % total
+		assigned += weights[i]
+	}
+	order := make([]int, len(backends))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; assigned < 100; i++ {
+		weights[order[i%len(order)]]++
+		assigned++
+	}
+	return weights
+}
+
+func istioDestination(b backendRef) thirdparty.IstioDestination {
+	return thirdparty.IstioDestination{Host: b.Name, Port: &thirdparty.IstioPortSelector{Number: uint32(b.Port)}}
+}
+
+// istioHTTPMatches translates a route matcher into VirtualService matches, one per method
+// and, for routes on some of the hosts, per host
+func istioHTTPMatches(m matcher, hosts []string, allHosts []string) ([]thirdparty.IstioHTTPMatchRequest, error) {
+	if m.Typed == nil {
+		return nil, fmt.Errorf("istio output can not express match %s, use the typed match fields", m.Rule)
+	}
+	match := thirdparty.IstioHTTPMatchRequest{}
+	if m.Typed.Path != "" {
+		match.URI = &thirdparty.IstioStringMatch{Exact: m.Typed.Path}
+	}
+	if m.Typed.PathPrefix != "" {
+		match.URI = &thirdparty.IstioStringMatch{Prefix: m.Typed.PathPrefix}
+	}
+	for _, k := range sortedKeys(m.Typed.Headers) {
+		if match.Headers == nil {
+			match.Headers = map[string]thirdparty.IstioStringMatch{}
+		}
+		match.Headers[k] = thirdparty.IstioStringMatch{Exact: m.Typed.Headers[k]}
+	}
+	for _, k := range sortedKeys(m.Typed.Query) {
+		if match.QueryParams == nil {
+			match.QueryParams = map[string]thirdparty.IstioStringMatch{}
+		}
+		match.QueryParams[k] = thirdparty.IstioStringMatch{Exact: m.Typed.Query[k]}
+	}
+
+	matches := []thirdparty.IstioHTTPMatchRequest{match}
+	if len(m.Typed.Methods) > 0 {
+		matches = nil
+		for _, method := range m.Typed.Methods {
+			methodMatch := match
+			methodMatch.Method = &thirdparty.IstioStringMatch{Exact: method}
+			matches = append(matches, methodMatch)
+		}
+	}
+	if len(hosts) == len(allHosts) {
+		return matches, nil
+	}
+	var hostMatches []thirdparty.IstioHTTPMatchRequest
+	for _, host := range hosts {
+		for _, match := range matches {
+			match.Authority = &thirdparty.IstioStringMatch{Exact: host}
+			hostMatches = append(hostMatches, match)
+		}
+	}
+	return hostMatches, nil
+}
+
+// istioHTTPRoute renders a route's backends, mirror, timeouts and policies
+func istioHTTPRoute(name string, r httpRoute, allHosts []string) (thirdparty.IstioHTTPRoute, error) {
+	if unsupported := r.Policies.unsupported("cors", "requestHeaders", "responseHeaders"); len(unsupported) > 0 {
+		return thirdparty.IstioHTTPRoute{}, fmt.Errorf("istio output does not support %s on route %s", strings.Join(unsupported, ", "), r.Match.Rule)
+	}
+	if r.ClientAuth != nil {
+		return thirdparty.IstioHTTPRoute{}, fmt.Errorf("istio output does not support clientAuth on route %s", r.Match.Rule)
+	}
+	if r.Priority != 0 {
+		return thirdparty.IstioHTTPRoute{}, fmt.Errorf("istio output does not support priority on route %s, routes match in order", r.Match.Rule)
+	}
+	if r.BackendTLS != nil {
+		return thirdparty.IstioHTTPRoute{}, fmt.Errorf("istio output does not support backendTLS on route %s, the mesh encrypts backend traffic", r.Match.Rule)
+	}
+	matches, err := istioHTTPMatches(r.Match, r.Hosts, allHosts)
+	if err != nil {
+		return thirdparty.IstioHTTPRoute{}, err
+	}
+	route := thirdparty.IstioHTTPRoute{Name: name, Match: matches}
+
+	weights := istioWeights(r.Backends)
+	for i, b := range r.Backends {
+		destination := thirdparty.IstioRouteDestination{Destination: istioDestination(b)}
+		if len(r.Backends) > 1 {
+			destination.Weight = weights[i]
+		}
+		route.Route = append(route.Route, destination)
+	}
+	if len(r.Mirrors) > 1 {
+		return thirdparty.IstioHTTPRoute{}, fmt.Errorf("istio output can only mirror route %s to a single service", r.Match.Rule)
+	}
+	for _, m := range r.Mirrors {
+		route.Mirror = utils.PointerTo(istioDestination(m.backendRef))
+		route.MirrorPercentage = &thirdparty.IstioPercent{Value: float64(m.Percent)}
+	}
+
+	if r.Timeout != "" {
+		route.Timeout = istioDuration(r.Timeout)
+	}
+	if r.Retries != nil {
+		route.Retries = &thirdparty.IstioHTTPRetry{
+			Attempts: r.Retries.Attempts,
+			RetryOn:  strings.Join(r.Retries.RetryOn, ","),
+		}
+		if r.Retries.PerTryTimeout != "" {
+			route.Retries.PerTryTimeout = istioDuration(r.Retries.PerTryTimeout)
+		}
+	}
+
+	p := r.Policies
+	if len(p.RequestHeaders) > 0 || len(p.ResponseHeaders) > 0 {
+		route.Headers = &thirdparty.IstioHeaders{}
+		if len(p.RequestHeaders) > 0 {
+			route.Headers.Request = &thirdparty.IstioHeaderOperations{Set: p.RequestHeaders}
+		}
+		if len(p.ResponseHeaders) > 0 {
+			route.Headers.Response = &thirdparty.IstioHeaderOperations{Set: p.ResponseHeaders}
+		}
+	}
+	if p.Cors != nil {
+		cors := &thirdparty.IstioCorsPolicy{
+			AllowMethods:  p.Cors.AllowMethods,
+			AllowHeaders:  p.Cors.AllowHeaders,
+			ExposeHeaders: p.Cors.ExposeHeaders,
+		}
+		for _, origin := range p.Cors.AllowOrigins {
+			cors.AllowOrigins = append(cors.AllowOrigins, thirdparty.IstioStringMatch{Exact: origin})
+		}
+		if p.Cors.MaxAge > 0 {
+			cors.MaxAge = fmt.Sprintf("%ds", p.Cors.MaxAge)
+		}
+		if p.Cors.AllowCredentials {
+			cors.AllowCredentials = utils.PointerTo(true)
+		}
+		route.CorsPolicy = cors
+	}
+	return route, nil
+}
+
+// istioAllowlistRule denies a vpn route's requests from outside its network profile
+func istioAllowlistRule(r httpRoute) (thirdparty.IstioRule, error) {
+	if r.Match.Typed == nil {
+		return thirdparty.IstioRule{}, fmt.Errorf("istio output can not restrict match %s to a network profile, use the typed match fields", r.Match.Rule)
+	}
+	if len(r.Match.Typed.Query) > 0 {
+		return thirdparty.IstioRule{}, fmt.Errorf("istio output can not restrict route %s to a network profile by query", r.Match.Rule)
+	}
+	operation := thirdparty.IstioOperation{Hosts: r.Hosts, Methods: r.Match.Typed.Methods}
+	if r.Match.Typed.Path != "" {
+		operation.Paths = []string{r.Match.Typed.Path}
+	}
+	if r.Match.Typed.PathPrefix != "" {
+		operation.Paths = []string{r.Match.Typed.PathPrefix + "*"}
+	}
+	rule := thirdparty.IstioRule{
+		From: []thirdparty.IstioRuleFrom{{Source: thirdparty.IstioSource{NotRemoteIPBlocks: r.Allowlist.SourceRanges}}},
+		To:   []thirdparty.IstioRuleTo{{Operation: operation}},
+	}
+	for _, k := range sortedKeys(r.Match.Typed.Headers) {
+		rule.When = append(rule.When, thirdparty.IstioCondition{
+			Key:    fmt.Sprintf("request.headers[%s]", k),
+			Values: []string{r.Match.Typed.Headers[k]},
+		})
+	}
+	return rule, nil
+}
+
+func newAuthorizationPolicy(name string, app string) thirdparty.AuthorizationPolicy {
+	return thirdparty.AuthorizationPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "AuthorizationPolicy",
+			APIVersion: apiVersionIstioSecurity,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: thirdparty.AuthorizationPolicySpec{
+			Selector: &thirdparty.IstioWorkloadSelector{MatchLabels: map[string]string{"app": app}},
+			Action:   "DENY",
+		},
+	}
+}
+
+// istioHosts are the hosts of the Gateway and VirtualService, which Istio requires. Without
+// hosts the routes match any host, like on the other outputs
+func istioHosts(hosts []string) []string {
+	if len(hosts) == 0 {
+		return []string{"*"}
+	}
+	return makeCopy(hosts)
+}
+
+// istioGateway serves the hosts over https with the planned certificates, redirecting http,
+// and the internal grpc host over plain http
+func istioGateway(model *routeModel, conf *istioConfig) thirdparty.IstioGateway {
+	selector := conf.Selector
+	if len(selector) == 0 {
+		selector = map[string]string{"istio": "ingressgateway"}
+	}
+	gateway := thirdparty.IstioGateway{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Gateway",
+			APIVersion: apiVersionIstioNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: model.App,
+		},
+		Spec: thirdparty.IstioGatewaySpec{
+			Selector: selector,
+			Servers: []thirdparty.IstioServer{
+				{
+					Port:  thirdparty.IstioPort{Number: 80, Name: "http", Protocol: "HTTP"},
+					Hosts: istioHosts(model.Hosts),
+				},
+			},
+		},
+	}
+	// without certificates there is no https server to redirect to
+	if len(model.TLS) > 0 {
+		gateway.Spec.Servers[0].TLS = &thirdparty.IstioServerTLS{HTTPSRedirect: true}
+	}
+	for i, c := range model.TLS {
+		name := "https"
+		if i > 0 {
+			name = fmt.Sprintf("https-%d", i)
+		}
+		gateway.Spec.Servers = append(gateway.Spec.Servers, thirdparty.IstioServer{
+			Port:  thirdparty.IstioPort{Number: 443, Name: name, Protocol: "HTTPS"},
+			Hosts: makeCopy(c.Hosts),
+			TLS:   &thirdparty.IstioServerTLS{Mode: "SIMPLE", CredentialName: c.SecretName},
+		})
+	}
+	if model.GRPC != nil {
+		gateway.Spec.Servers = append(gateway.Spec.Servers, thirdparty.IstioServer{
+			Port:  thirdparty.IstioPort{Number: 80, Name: "grpc", Protocol: "HTTP"},
+			Hosts: []string{model.GRPC.Host},
+		})
+	}
+	return gateway
+}
+
+// renderIstio renders the route model as an Istio Gateway, VirtualServices and a DestinationRule
+// for the app's Service. vpn routes are enforced at the app's sidecar by AuthorizationPolicies
+func renderIstio(model *routeModel, conf *istioConfig) ([]*yaml.RNode, error) {
+	if conf == nil {
+		conf = &istioConfig{}
+	}
+	var resources []any
+	gatewayName := conf.Gateway
+	if gatewayName == "" {
+		resources = append(resources, istioGateway(model, conf))
+		gatewayName = model.App
+	}
+
+	virtualService := thirdparty.VirtualService{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "VirtualService",
+			APIVersion: apiVersionIstioNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: model.App,
+		},
+		Spec: thirdparty.VirtualServiceSpec{
+			Hosts:    istioHosts(model.Hosts),
+			Gateways: []string{gatewayName},
+		},
+	}
+	// vpn routes of each network profile share a policy, in order of first use
+	var policies []*thirdparty.AuthorizationPolicy
+	byProfile := map[string]*thirdparty.AuthorizationPolicy{}
+
+	for i, r := range model.HTTP {
+		route, err := istioHTTPRoute(fmt.Sprintf("route%d", i), r, model.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		virtualService.Spec.HTTP = append(virtualService.Spec.HTTP, route)
+
+		if r.Allowlist == nil {
+			continue
+		}
+		if r.Allowlist.SourceRanges == nil {
+			return nil, fmt.Errorf("vpn route %s needs networkProfiles for istio output", r.Match.Rule)
+		}
+		rule, err := istioAllowlistRule(r)
+		if err != nil {
+			return nil, err
+		}
+		policy := byProfile[r.Allowlist.Profile]
+		if policy == nil {
+			policy = utils.PointerTo(newAuthorizationPolicy(fmt.Sprintf("%s-%s-allowlist", model.App, r.Allowlist.Profile), model.App))
+			byProfile[r.Allowlist.Profile] = policy
+			policies = append(policies, policy)
+		}
+		policy.Spec.Rules = append(policy.Spec.Rules, rule)
+	}
+	if len(virtualService.Spec.HTTP) > 0 {
+		resources = append(resources, virtualService)
+	}
+	for _, p := range policies {
+		resources = append(resources, *p)
+	}
+
+	if model.GRPC != nil {
+		grpcHosts := []string{model.GRPC.Host}
+		for _, e := range model.GRPC.External {
+			grpcHosts = append(grpcHosts, e.Hosts...)
+		}
+		route := thirdparty.IstioHTTPRoute{
+			Name:  "grpc",
+			Route: []thirdparty.IstioRouteDestination{{Destination: istioDestination(model.GRPC.Backend)}},
+		}
+		for _, m := range model.GRPC.Methods {
+			uri := &thirdparty.IstioStringMatch{Exact: m.path()}
+			if m.Method == "" {
+				uri = &thirdparty.IstioStringMatch{Prefix: m.path()}
+			}
+			route.Match = append(route.Match, thirdparty.IstioHTTPMatchRequest{URI: uri})
+		}
+		resources = append(resources, thirdparty.VirtualService{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "VirtualService",
+				APIVersion: apiVersionIstioNetworking,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-grpc", model.App),
+			},
+			Spec: thirdparty.VirtualServiceSpec{
+				Hosts:    grpcHosts,
+				Gateways: []string{gatewayName},
+				HTTP:     []thirdparty.IstioHTTPRoute{route},
+			},
+		})
+	}
+
+	// the app's Service is only reached through the mesh
+	resources = append(resources, thirdparty.DestinationRule{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DestinationRule",
+			APIVersion: apiVersionIstioNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: model.App,
+		},
+		Spec: thirdparty.DestinationRuleSpec{
+			Host: model.App,
+			TrafficPolicy: &thirdparty.IstioTrafficPolicy{
+				TLS: &thirdparty.IstioClientTLS{Mode: "ISTIO_MUTUAL"},
+			},
+		},
+	})
+
+	out := []*yaml.RNode{}
+	for _, r := range resources {
+		node, err := fnutils.MakeRNode(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
@@ -0,0 +1,234 @@
+package networking
+
+import (
+	"fmt"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"github.com/bukukasio/krm-functions/pkg/common/service"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	ingressRouteTCPKind = "IngressRouteTCP"
+	ingressRouteUDPKind = "IngressRouteUDP"
+)
+
+// tcpRouteConfig exposes a container port of the app over TCP on Traefik entrypoints
+type tcpRouteConfig struct {
+	// Port is the name of a container port of the app container
+	Port        string   `json:"port"`
+	EntryPoints []string `json:"entryPoints"`
+	// SNI matches TLS server names. It needs tls, when empty plain TCP matches any connection
+	// and terminated TLS the config's hosts
+	SNI []string      `json:"sni,omitempty"`
+	TLS *tcpTLSConfig `json:"tls,omitempty"`
+}
+
+// tcpTLSConfig terminates TLS with the config's certificate, or passes it through to the app
+type tcpTLSConfig struct {
+	Passthrough bool `json:"passthrough,omitempty"`
+}
+
+// udpRouteConfig exposes a container port of the app over UDP on Traefik entrypoints
+type udpRouteConfig struct {
+	Port        string   `json:"port"`
+	EntryPoints []string `json:"entryPoints"`
+}
+
+type tcpRoute struct {
+	PortName    string
+	EntryPoints []string
+	SNI         []string
+	Passthrough bool
+	// TLSSecret terminates TLS, empty for plain TCP and passthrough
+	TLSSecret string
+	Backend   backendRef
+}
+
+type udpRoute struct {
+	PortName    string
+	EntryPoints []string
+	Backend     backendRef
+}
+
+// l4Port resolves a named container port with the protocol a route needs into its Service port
+func l4Port(w *workload, conf *service.Config, name string, protocol corev1.Protocol) (corev1.ServicePort, error) {
+	if name == "" {
+		return corev1.ServicePort{}, fmt.Errorf("port can not be empty")
+	}
+	port, err := w.namedPort(name)
+	if err != nil {
+		return corev1.ServicePort{}, err
+	}
+	portProtocol := port.Protocol
+	if portProtocol == "" {
+		portProtocol = corev1.ProtocolTCP
+	}
+	if portProtocol != protocol {
+		return corev1.ServicePort{}, fmt.Errorf("container port %s is %s, expected %s", name, portProtocol, protocol)
+	}
+	return conf.ServicePort(port), nil
+}
+
+// tcpTLSSecret is the certificate that covers all sni hosts
+func tcpTLSSecret(sni []string, certificates []tlsCertificate) (string, error) {
+	for _, c := range certificates {
+		covered := 0
+		for _, host := range sni {
+			for _, h := range c.Hosts {
+				if h == host {
+					covered++
+					break
+				}
+			}
+		}
+		if covered == len(sni) {
+			return c.SecretName, nil
+		}
+	}
+	return "", fmt.Errorf("sni hosts %v are not covered by a single certificate", sni)
+}
+
+// buildL4Routes resolves tcpRoutes and udpRoutes against the workload's container ports, which
+// the app's Service exposes
+func buildL4Routes(fn *networkingSpec, w *workload, serviceName string, certificates []tlsCertificate) ([]tcpRoute, []udpRoute, error) {
+	var tcpRoutes []tcpRoute
+	var udpRoutes []udpRoute
+	seen := map[string]bool{}
+
+	for i, r := range fn.TCPRoutes {
+		path := fmt.Sprintf("spec.tcpRoutes[%d]", i)
+		if len(r.EntryPoints) == 0 {
+			return nil, nil, fieldError(path, fmt.Errorf("tcp route %s needs entryPoints", r.Port))
+		}
+		if seen[r.Port] {
+			return nil, nil, fieldError(path, fmt.Errorf("port %s is exposed twice", r.Port))
+		}
+		seen[r.Port] = true
+		port, err := l4Port(w, fn.Service, r.Port, corev1.ProtocolTCP)
+		if err != nil {
+			return nil, nil, fieldError(path+".port", err)
+		}
+		route := tcpRoute{
+			PortName:    r.Port,
+			EntryPoints: r.EntryPoints,
+			SNI:         r.SNI,
+			Backend:     backendRef{Name: serviceName, Port: port.Port},
+		}
+		switch {
+		case r.TLS == nil && len(r.SNI) > 0:
+			return nil, nil, fieldError(path+".sni", fmt.Errorf("sni matching needs tls"))
+		case r.TLS != nil && r.TLS.Passthrough:
+			if len(r.SNI) == 0 {
+				return nil, nil, fieldError(path+".sni", fmt.Errorf("tls passthrough needs sni hosts"))
+			}
+			route.Passthrough = true
+		case r.TLS != nil:
+			// the config's certificate terminates TLS, so sni hosts have to be declared
+			route.SNI, err = routeHosts(fn.Hosts, r.SNI)
+			if err != nil {
+				return nil, nil, fieldError(path+".sni", err)
+			}
+			route.TLSSecret, err = tcpTLSSecret(route.SNI, certificates)
+			if err != nil {
+				return nil, nil, fieldError(path+".sni", err)
+			}
+		}
+		tcpRoutes = append(tcpRoutes, route)
+	}
+
+	for i, r := range fn.UDPRoutes {
+		path := fmt.Sprintf("spec.udpRoutes[%d]", i)
+		if len(r.EntryPoints) == 0 {
+			return nil, nil, fieldError(path, fmt.Errorf("udp route %s needs entryPoints", r.Port))
+		}
+		if seen[r.Port] {
+			return nil, nil, fieldError(path, fmt.Errorf("port %s is exposed twice", r.Port))
+		}
+		seen[r.Port] = true
+		port, err := l4Port(w, fn.Service, r.Port, corev1.ProtocolUDP)
+		if err != nil {
+			return nil, nil, fieldError(path+".port", err)
+		}
+		udpRoutes = append(udpRoutes, udpRoute{
+			PortName:    r.Port,
+			EntryPoints: r.EntryPoints,
+			Backend:     backendRef{Name: serviceName, Port: port.Port},
+		})
+	}
+	return tcpRoutes, udpRoutes, nil
+}
+
+// renderTraefikL4 renders tcp and udp routes as IngressRouteTCP and IngressRouteUDP
+func renderTraefikL4(model *routeModel) ([]*yaml.RNode, error) {
+	var routes []any
+	for _, r := range model.TCP {
+		match := "HostSNI(`*`)"
+		if len(r.SNI) > 0 {
+			match = fmt.Sprintf("HostSNI(%s)", quoteArgs(r.SNI))
+		}
+		route := traefik.IngressRouteTCP{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       ingressRouteTCPKind,
+				APIVersion: apiVersionNetworking,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-tcp-%s", model.App, r.PortName),
+			},
+			Spec: traefik.IngressRouteTCPSpec{
+				EntryPoints: r.EntryPoints,
+				Routes: []traefik.RouteTCP{
+					{
+						Match: match,
+						Services: []traefik.ServiceTCP{
+							{Name: r.Backend.Name, Port: intstr.FromInt(int(r.Backend.Port))},
+						},
+					},
+				},
+			},
+		}
+		if r.Passthrough || r.TLSSecret != "" {
+			route.Spec.TLS = &traefik.TLSTCP{
+				Passthrough: r.Passthrough,
+				SecretName:  r.TLSSecret,
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	for _, r := range model.UDP {
+		routes = append(routes, traefik.IngressRouteUDP{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       ingressRouteUDPKind,
+				APIVersion: apiVersionNetworking,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("%s-udp-%s", model.App, r.PortName),
+			},
+			Spec: traefik.IngressRouteUDPSpec{
+				EntryPoints: r.EntryPoints,
+				Routes: []traefik.RouteUDP{
+					{
+						Services: []traefik.ServiceUDP{
+							{Name: r.Backend.Name, Port: intstr.FromInt(int(r.Backend.Port))},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	out := []*yaml.RNode{}
+	for _, r := range routes {
+		node, err := fnutils.MakeRNode(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
@@ -0,0 +1,340 @@
+package networking
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// routeMatch is the typed form of a route matcher, every field that is set has to match
+type routeMatch struct {
+	Path       string            `json:"path,omitempty"`
+	PathPrefix string            `json:"pathPrefix,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Methods    []string          `json:"methods,omitempty"`
+	Query      map[string]string `json:"query,omitempty"`
+}
+
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+func (m *routeMatch) isEmpty() bool {
+	return m.Path == "" && m.PathPrefix == "" && len(m.Headers) == 0 && len(m.Methods) == 0 && len(m.Query) == 0
+}
+
+func (m *routeMatch) validate() error {
+	if m.isEmpty() {
+		return fmt.Errorf("route has no match, set one of path, pathPrefix, headers, methods, query or match")
+	}
+	if m.Path != "" && m.PathPrefix != "" {
+		return fmt.Errorf("path and pathPrefix are mutually exclusive")
+	}
+	for _, p := range []string{m.Path, m.PathPrefix} {
+		if p != "" && !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path %s has to start with /", p)
+		}
+	}
+	for _, method := range m.Methods {
+		if !httpMethods[method] {
+			return fmt.Errorf("unknown http method %s", method)
+		}
+	}
+	for k := range m.Headers {
+		if k == "" {
+			return fmt.Errorf("header name can not be empty")
+		}
+	}
+	for k := range m.Query {
+		if k == "" {
+			return fmt.Errorf("query parameter name can not be empty")
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// traefikRule compiles the match to Traefik rule syntax
+func (m *routeMatch) traefikRule() string {
+	var parts []string
+	if m.Path != "" {
+		parts = append(parts, fmt.Sprintf("Path(`%s`)", m.Path))
+	}
+	if m.PathPrefix != "" {
+		parts = append(parts, fmt.Sprintf("PathPrefix(`%s`)", m.PathPrefix))
+	}
+	if len(m.Methods) > 0 {
+		parts = append(parts, fmt.Sprintf("Method(%s)", quoteArgs(m.Methods)))
+	}
+	for _, k := range sortedKeys(m.Headers) {
+		parts = append(parts, fmt.Sprintf("Headers(`%s`, `%s`)", k, m.Headers[k]))
+	}
+	for _, k := range sortedKeys(m.Query) {
+		parts = append(parts, fmt.Sprintf("Query(`%s=%s`)", k, m.Query[k]))
+	}
+	return strings.Join(parts, " && ")
+}
+
+func quoteArgs(args []string) string {
+	quoted := []string{}
+	for _, a := range args {
+		quoted = append(quoted, fmt.Sprintf("`%s`", a))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// matcher is a validated route matcher. Rule is always the Traefik form, Typed is only
+// nil for a raw rule that other outputs can not express, e.g. one using || or !
+type matcher struct {
+	Rule  string
+	Typed *routeMatch
+}
+
+func typedMatcher(m routeMatch) (matcher, error) {
+	if err := m.validate(); err != nil {
+		return matcher{}, err
+	}
+	return matcher{Rule: m.traefikRule(), Typed: &m}, nil
+}
+
+// rawMatcher syntax checks a raw Traefik rule and converts it to the typed form when it can
+func rawMatcher(rule string) (matcher, error) {
+	if strings.TrimSpace(rule) == "" {
+		return matcher{}, fmt.Errorf("match is empty")
+	}
+	node, err := parseRule(rule)
+	if err != nil {
+		return matcher{}, fmt.Errorf("invalid match %s: %w", rule, err)
+	}
+	m := matcher{Rule: strings.TrimSpace(rule)}
+	typed := routeMatch{}
+	if node.toTyped(&typed) && typed.validate() == nil {
+		m.Typed = &typed
+	}
+	return m, nil
+}
+
+// ruleNode is a parsed Traefik rule, either an operator over Children or a matcher call
+type ruleNode struct {
+	Op       string
+	Matcher  string
+	Args     []string
+	Children []*ruleNode
+}
+
+// traefikMatchers are the Traefik v2 rule matchers with the number of arguments they
+// take, -1 meaning one or more
+var traefikMatchers = map[string]int{
+	"Host":          -1,
+	"HostHeader":    -1,
+	"HostRegexp":    -1,
+	"Path":          -1,
+	"PathPrefix":    -1,
+	"Method":        -1,
+	"Headers":       2,
+	"HeadersRegexp": 2,
+	"Query":         -1,
+	"ClientIP":      -1,
+}
+
+// toTyped folds a conjunction of Path, PathPrefix, Method, Headers and Query matchers into m.
+// It returns false for anything that has no typed equivalent
+func (n *ruleNode) toTyped(m *routeMatch) bool {
+	switch n.Op {
+	case "&&":
+		return n.Children[0].toTyped(m) && n.Children[1].toTyped(m)
+	case "":
+	default:
+		return false
+	}
+
+	switch n.Matcher {
+	case "Path", "PathPrefix":
+		// several paths are or'ed, and there is only room for one
+		if len(n.Args) != 1 || m.Path != "" || m.PathPrefix != "" {
+			return false
+		}
+		if n.Matcher == "Path" {
+			m.Path = n.Args[0]
+		} else {
+			m.PathPrefix = n.Args[0]
+		}
+	case "Method":
+		if len(m.Methods) > 0 {
+			return false
+		}
+		m.Methods = n.Args
+	case "Headers":
+		if m.Headers == nil {
+			m.Headers = map[string]string{}
+		}
+		m.Headers[n.Args[0]] = n.Args[1]
+	case "Query":
+		if m.Query == nil {
+			m.Query = map[string]string{}
+		}
+		for _, arg := range n.Args {
+			k, v, ok := strings.Cut(arg, "=")
+			if !ok {
+				return false
+			}
+			m.Query[k] = v
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+type ruleParser struct {
+	input string
+	pos   int
+}
+
+func parseRule(rule string) (*ruleNode, error) {
+	p := &ruleParser{input: rule}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+func (p *ruleParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips whitespace and then token, if the input continues with it
+func (p *ruleParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *ruleParser) parseOr() (*ruleNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &ruleNode{Op: "||", Children: []*ruleNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseAnd() (*ruleNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &ruleNode{Op: "&&", Children: []*ruleNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *ruleParser) parseUnary() (*ruleNode, error) {
+	if p.consume("!") {
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &ruleNode{Op: "!", Children: []*ruleNode{child}}, nil
+	}
+	if p.consume("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		return node, nil
+	}
+	return p.parseMatcher()
+}
+
+func (p *ruleParser) parseMatcher() (*ruleNode, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) && unicode.IsLetter(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("expected a matcher at %d", start)
+	}
+	argCount, ok := traefikMatchers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown matcher %s", name)
+	}
+	if !p.consume("(") {
+		return nil, fmt.Errorf("expected ( after %s", name)
+	}
+
+	node := &ruleNode{Matcher: name}
+	for {
+		arg, err := p.parseString()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		node.Args = append(node.Args, arg)
+		if p.consume(")") {
+			break
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("%s: expected , or ) at %d", name, p.pos)
+		}
+	}
+
+	if argCount > 0 && len(node.Args) != argCount {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, argCount, len(node.Args))
+	}
+	return node, nil
+}
+
+// parseString reads a backtick or double quoted string
+func (p *ruleParser) parseString() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return "", fmt.Errorf("expected a string at %d", p.pos)
+	}
+	quote := p.input[p.pos]
+	if quote != '`' && quote != '"' {
+		return "", fmt.Errorf("expected a ` or \" quoted string at %d", p.pos)
+	}
+	end := strings.IndexByte(p.input[p.pos+1:], quote)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at %d", p.pos)
+	}
+	s := p.input[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return s, nil
+}
@@ -0,0 +1,237 @@
+package networking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Below is table driven test for rawMatcher and typedMatcher
+// It checks syntax errors and the conversion between raw and typed matches
+func TestMatcher(t *testing.T) {
+	var tests = []struct {
+		name     string
+		route    RouteConfig
+		rule     string
+		typed    *routeMatch
+		errorMsg string
+	}{
+		{
+			name:  "typed path prefix and methods",
+			route: RouteConfig{routeMatch: routeMatch{PathPrefix: "/api", Methods: []string{"GET", "POST"}}},
+			rule:  "PathPrefix(`/api`) && Method(`GET`, `POST`)",
+			typed: &routeMatch{PathPrefix: "/api", Methods: []string{"GET", "POST"}},
+		},
+		{
+			name:  "typed headers and query are sorted",
+			route: RouteConfig{routeMatch: routeMatch{Path: "/v1", Headers: map[string]string{"X-B": "b", "X-A": "a"}, Query: map[string]string{"debug": "1"}}},
+			rule:  "Path(`/v1`) && Headers(`X-A`, `a`) && Headers(`X-B`, `b`) && Query(`debug=1`)",
+			typed: &routeMatch{Path: "/v1", Headers: map[string]string{"X-B": "b", "X-A": "a"}, Query: map[string]string{"debug": "1"}},
+		},
+		{
+			name:     "typed path and prefix",
+			route:    RouteConfig{routeMatch: routeMatch{Path: "/v1", PathPrefix: "/v2"}},
+			errorMsg: "path and pathPrefix are mutually exclusive",
+		},
+		{
+			name:     "typed relative path",
+			route:    RouteConfig{routeMatch: routeMatch{Path: "v1"}},
+			errorMsg: "path v1 has to start with /",
+		},
+		{
+			name:     "typed unknown method",
+			route:    RouteConfig{routeMatch: routeMatch{Methods: []string{"get"}}},
+			errorMsg: "unknown http method get",
+		},
+		{
+			name:     "no match at all",
+			route:    RouteConfig{},
+			errorMsg: "route has no match",
+		},
+		{
+			name:     "raw and typed",
+			route:    RouteConfig{Match: "Path(`/foo`)", routeMatch: routeMatch{Path: "/foo"}},
+			errorMsg: "match can not be combined with path",
+		},
+		{
+			name:  "raw conjunction converts to typed",
+			route: RouteConfig{Match: "PathPrefix(`/foo`) && Headers(`X-Env`, `dev`)"},
+			rule:  "PathPrefix(`/foo`) && Headers(`X-Env`, `dev`)",
+			typed: &routeMatch{PathPrefix: "/foo", Headers: map[string]string{"X-Env": "dev"}},
+		},
+		{
+			name:  "raw disjunction stays traefik only",
+			route: RouteConfig{Match: "Path(`/foo`) || (Path(\"/bar\") && !Query(`a=b`))"},
+			rule:  "Path(`/foo`) || (Path(\"/bar\") && !Query(`a=b`))",
+		},
+		{
+			name:     "raw unknown matcher",
+			route:    RouteConfig{Match: "Pth(`/foo`)"},
+			errorMsg: "unknown matcher Pth",
+		},
+		{
+			name:     "raw single quotes",
+			route:    RouteConfig{Match: "Path('/foo')"},
+			errorMsg: "expected a ` or \" quoted string",
+		},
+		{
+			name:     "raw unbalanced parens",
+			route:    RouteConfig{Match: "(Path(`/foo`) && Method(`GET`)"},
+			errorMsg: "missing )",
+		},
+		{
+			name:     "raw wrong argument count",
+			route:    RouteConfig{Match: "Headers(`X-Env`)"},
+			errorMsg: "Headers takes 2 arguments, got 1",
+		},
+		{
+			name:     "raw trailing operator",
+			route:    RouteConfig{Match: "Path(`/foo`) &&"},
+			errorMsg: "expected a matcher",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := test.route.matcher()
+			if test.errorMsg != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.errorMsg)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.rule, m.Rule)
+			assert.Equal(t, test.typed, m.Typed)
+		})
+	}
+}
+
+// TestSplitHosts checks that equivalent rules compare equal once the hosts are split off
+func TestSplitHosts(t *testing.T) {
+	var tests = []struct {
+		name  string
+		rule  string
+		hosts []string
+		match string
+	}{
+		{
+			name:  "or'ed hosts and typed rest",
+			rule:  "(Host(`a.com`) || Host(`B.com`)) && Method(`POST`, `GET`) && PathPrefix(`/api`)",
+			hosts: []string{"a.com", "b.com"},
+			match: "PathPrefix(`/api`) && Method(`GET`, `POST`)",
+		},
+		{
+			name:  "host only",
+			rule:  "Host(`a.com`, `b.com`)",
+			hosts: []string{"a.com", "b.com"},
+		},
+		{
+			name:  "no host",
+			rule:  "Path(`/health`)",
+			match: "Path(`/health`)",
+		},
+		{
+			name:  "disjunction with a host takes any host",
+			rule:  "Host(`a.com`) || Path(`/b`)",
+			match: "(Host(`a.com`) || Path(`/b`))",
+		},
+		{
+			name:  "untyped rest is sorted",
+			rule:  "Host(`a.com`) && !Path(`/b`) && ClientIP(`10.0.0.0/8`)",
+			hosts: []string{"a.com"},
+			match: "!Path(`/b`) && ClientIP(`10.0.0.0/8`)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := parseRule(test.rule)
+			if !assert.NoError(t, err) {
+				return
+			}
+			hosts, match, _ := splitHosts(rule)
+			assert.Equal(t, test.hosts, hosts)
+			assert.Equal(t, test.match, match)
+		})
+	}
+}
+
+func TestShadows(t *testing.T) {
+	claim := func(rule string, priority int) *routeClaim {
+		node, err := parseRule(rule)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		hosts, match, typed := splitHosts(node)
+		return &routeClaim{Hosts: hosts, Match: match, Typed: typed, Rule: rule, Priority: priority}
+	}
+	var tests = []struct {
+		name      string
+		broad     *routeClaim
+		narrow    *routeClaim
+		host      string
+		shadows   bool
+		identical bool
+	}{
+		{
+			name:    "prefix with a higher priority shadows a path under it",
+			broad:   claim("Host(`a.com`) && PathPrefix(`/api`)", 100),
+			narrow:  claim("Host(`a.com`) && Path(`/api/users`)", 0),
+			host:    "a.com",
+			shadows: true,
+		},
+		{
+			name:    "root prefix with a longer rule shadows anything on the host",
+			broad:   claim("Host(`a.com`, `b.com`, `c.com`) && PathPrefix(`/`)", 0),
+			narrow:  claim("Host(`a.com`) && Path(`/x`)", 0),
+			host:    "a.com",
+			shadows: true,
+		},
+		{
+			name:   "narrower route with a longer rule wins",
+			broad:  claim("Host(`a.com`) && PathPrefix(`/`)", 0),
+			narrow: claim("Host(`a.com`) && PathPrefix(`/api`)", 0),
+		},
+		{
+			name:   "prefix does not cover a sibling path",
+			broad:  claim("Host(`a.com`) && PathPrefix(`/api`)", 100),
+			narrow: claim("Host(`a.com`) && Path(`/admin`)", 0),
+		},
+		{
+			name:    "any method covers some methods",
+			broad:   claim("Host(`a.com`) && PathPrefix(`/api`)", 100),
+			narrow:  claim("Host(`a.com`) && PathPrefix(`/api`) && Method(`GET`)", 0),
+			host:    "a.com",
+			shadows: true,
+		},
+		{
+			name:   "other hosts are not shadowed",
+			broad:  claim("Host(`a.com`) && PathPrefix(`/`)", 100),
+			narrow: claim("Host(`b.com`) && Path(`/x`)", 0),
+		},
+		{
+			name:      "raw rule equivalent to a typed one",
+			broad:     claim("PathPrefix(`/api`) && Method(`POST`, `GET`) && Host(`a.com`)", 0),
+			narrow:    claim("Host(`a.com`) && PathPrefix(`/api`) && Method(`GET`, `POST`)", 0),
+			host:      "a.com",
+			identical: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host, ok := test.broad.shadows(test.narrow)
+			assert.Equal(t, test.shadows, ok)
+			if ok {
+				assert.Equal(t, test.host, host)
+			}
+			_, ok = test.narrow.shadows(test.broad)
+			assert.False(t, ok)
+			host, ok = test.broad.overlaps(test.narrow)
+			assert.Equal(t, test.identical, ok)
+			if ok {
+				assert.Equal(t, test.host, host)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package networking
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	"github.com/traefik/traefik/v2/pkg/config/dynamic"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const middlewareKind = "Middleware"
+
+// httpPolicies are the per route HTTP policies, rendered as Traefik Middlewares
+type httpPolicies struct {
+	RateLimit       *rateLimitPolicy  `json:"rateLimit,omitempty"`
+	Cors            *corsPolicy       `json:"cors,omitempty"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	// StripPrefix strips the route's pathPrefix before forwarding
+	StripPrefix bool             `json:"stripPrefix,omitempty"`
+	Redirect    *redirectPolicy  `json:"redirect,omitempty"`
+	Compress    bool             `json:"compress,omitempty"`
+	BasicAuth   *basicAuthPolicy `json:"basicAuth,omitempty"`
+}
+
+type rateLimitPolicy struct {
+	// Average is the number of requests allowed per Period
+	Average int64 `json:"average"`
+	Burst   int64 `json:"burst,omitempty"`
+	// Period is a duration like 1s or 1m, 1s when empty
+	Period string `json:"period,omitempty"`
+}
+
+type corsPolicy struct {
+	AllowOrigins     []string `json:"allowOrigins"`
+	AllowMethods     []string `json:"allowMethods,omitempty"`
+	AllowHeaders     []string `json:"allowHeaders,omitempty"`
+	ExposeHeaders    []string `json:"exposeHeaders,omitempty"`
+	AllowCredentials bool     `json:"allowCredentials,omitempty"`
+	MaxAge           int64    `json:"maxAge,omitempty"`
+}
+
+type redirectPolicy struct {
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+	Permanent   bool   `json:"permanent,omitempty"`
+}
+
+// basicAuthPolicy references a secret with htpasswd formatted users
+type basicAuthPolicy struct {
+	Secret       string `json:"secret"`
+	Realm        string `json:"realm,omitempty"`
+	RemoveHeader bool   `json:"removeHeader,omitempty"`
+}
+
+var durationPattern = regexp.MustCompile(`^[0-9]+(ms|s|m|h)$`)
+
+// names lists the policies that are set, in the order their middlewares run
+func (p *httpPolicies) names() []string {
+	var names []string
+	if p.BasicAuth != nil {
+		names = append(names, "basicAuth")
+	}
+	if p.RateLimit != nil {
+		names = append(names, "rateLimit")
+	}
+	if p.Cors != nil {
+		names = append(names, "cors")
+	}
+	if len(p.RequestHeaders) > 0 {
+		names = append(names, "requestHeaders")
+	}
+	if len(p.ResponseHeaders) > 0 {
+		names = append(names, "responseHeaders")
+	}
+	if p.Redirect != nil {
+		names = append(names, "redirect")
+	}
+	if p.StripPrefix {
+		names = append(names, "stripPrefix")
+	}
+	if p.Compress {
+		names = append(names, "compress")
+	}
+	return names
+}
+
+// unsupported returns the policies that are set but not in supported
+func (p *httpPolicies) unsupported(supported ...string) []string {
+	var out []string
+	for _, name := range p.names() {
+		found := false
+		for _, s := range supported {
+			if name == s {
+				found = true
+			}
+		}
+		if !found {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (p *httpPolicies) validate(m *routeMatch) error {
+	if p.RateLimit != nil {
+		if p.RateLimit.Average <= 0 {
+			return fmt.Errorf("rateLimit.average has to be positive")
+		}
+		if p.RateLimit.Period != "" && !durationPattern.MatchString(p.RateLimit.Period) {
+			return fmt.Errorf("rateLimit.period %s is not a duration like 1s or 1m", p.RateLimit.Period)
+		}
+	}
+	if p.Cors != nil && len(p.Cors.AllowOrigins) == 0 {
+		return fmt.Errorf("cors.allowOrigins can not be empty")
+	}
+	if p.StripPrefix && (m == nil || m.PathPrefix == "") {
+		return fmt.Errorf("stripPrefix needs the route to match on pathPrefix")
+	}
+	if p.Redirect != nil {
+		if p.Redirect.Regex == "" || p.Redirect.Replacement == "" {
+			return fmt.Errorf("redirect needs regex and replacement")
+		}
+		if _, err := regexp.Compile(p.Redirect.Regex); err != nil {
+			return fmt.Errorf("redirect.regex: %w", err)
+		}
+	}
+	if p.BasicAuth != nil && p.BasicAuth.Secret == "" {
+		return fmt.Errorf("basicAuth.secret can not be empty")
+	}
+	return nil
+}
+
+func newMiddleware(name string, spec traefik.MiddlewareSpec) traefik.Middleware {
+	return traefik.Middleware{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       middlewareKind,
+			APIVersion: apiVersionNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+// traefikMiddlewares builds the Middlewares for a route's policies, named after prefix
+func traefikMiddlewares(prefix string, p *httpPolicies, m *routeMatch) []traefik.Middleware {
+	var out []traefik.Middleware
+	if p.BasicAuth != nil {
+		out = append(out, newMiddleware(prefix+"-basic-auth", traefik.MiddlewareSpec{
+			BasicAuth: &traefik.BasicAuth{
+				Secret:       p.BasicAuth.Secret,
+				Realm:        p.BasicAuth.Realm,
+				RemoveHeader: p.BasicAuth.RemoveHeader,
+			},
+		}))
+	}
+	if p.RateLimit != nil {
+		period := p.RateLimit.Period
+		if period == "" {
+			period = "1s"
+		}
+		rateLimit := &traefik.RateLimit{
+			Average: p.RateLimit.Average,
+			Period:  utils.PointerTo(intstr.FromString(period)),
+		}
+		if p.RateLimit.Burst != 0 {
+			rateLimit.Burst = &p.RateLimit.Burst
+		}
+		out = append(out, newMiddleware(prefix+"-rate-limit", traefik.MiddlewareSpec{
+			RateLimit: rateLimit,
+		}))
+	}
+	// cors and custom headers are all done by the headers middleware
+	if p.Cors != nil || len(p.RequestHeaders) > 0 || len(p.ResponseHeaders) > 0 {
+		headers := &dynamic.Headers{
+			CustomRequestHeaders:  p.RequestHeaders,
+			CustomResponseHeaders: p.ResponseHeaders,
+		}
+		if p.Cors != nil {
+			headers.AccessControlAllowOriginList = p.Cors.AllowOrigins
+			headers.AccessControlAllowMethods = p.Cors.AllowMethods
+			headers.AccessControlAllowHeaders = p.Cors.AllowHeaders
+			headers.AccessControlExposeHeaders = p.Cors.ExposeHeaders
+			headers.AccessControlAllowCredentials = p.Cors.AllowCredentials
+			headers.AccessControlMaxAge = p.Cors.MaxAge
+			headers.AddVaryHeader = true
+		}
+		out = append(out, newMiddleware(prefix+"-headers", traefik.MiddlewareSpec{
+			Headers: headers,
+		}))
+	}
+	if p.Redirect != nil {
+		out = append(out, newMiddleware(prefix+"-redirect", traefik.MiddlewareSpec{
+			RedirectRegex: &dynamic.RedirectRegex{
+				Regex:       p.Redirect.Regex,
+				Replacement: p.Redirect.Replacement,
+				Permanent:   p.Redirect.Permanent,
+			},
+		}))
+	}
+	if p.StripPrefix {
+		out = append(out, newMiddleware(prefix+"-strip-prefix", traefik.MiddlewareSpec{
+			StripPrefix: &dynamic.StripPrefix{
+				Prefixes: []string{strings.TrimSuffix(m.PathPrefix, "/")},
+			},
+		}))
+	}
+	if p.Compress {
+		out = append(out, newMiddleware(prefix+"-compress", traefik.MiddlewareSpec{
+			Compress: &dynamic.Compress{},
+		}))
+	}
+	return out
+}
@@ -1,381 +1,483 @@
+// +groupName=krm
 package networking
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"strings"
 
-	yml "sigs.k8s.io/yaml"
-
 	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
-	cv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
-	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
-	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
-	v1 "k8s.io/api/apps/v1"
+	"github.com/bukukasio/krm-functions/pkg/common/service"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	openapispec "k8s.io/kube-openapi/pkg/validation/spec"
+	kerrors "sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 	"sigs.k8s.io/kustomize/kyaml/yaml"
 )
 
+// outputs are the ingress implementations a config can render routes for
 const (
-	ingressRouteKind     = "IngressRoute"
-	apiVersionNetworking = "traefik.containo.us/v1alpha1"
+	outputTraefik    = "traefik"
+	outputGatewayAPI = "gateway-api"
+	outputIngress    = "ingress"
+	outputIstio      = "istio"
 )
 
-type injectResult struct {
-	Source   *yaml.RNode
-	Route    *yaml.RNode
-	ErrorMsg string
-}
-type InjectRoutes struct {
-	fnConfig      *yaml.RNode
-	injectResults []*injectResult
+// +kubebuilder:object:root=true
+type FunctionConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	// +optional
+	Spec *networkingSpec `json:"spec,omitempty"`
+	// Data is the legacy layout of spec, still read but deprecated
+	// +optional
+	Data *networkingSpec `json:"data,omitempty"`
+
+	// legacy is set when the spec was read from data
+	legacy bool `json:"-"`
+	// unknownData reports the fields of data the function ignored
+	unknownData error `json:"-"`
+	// results report what the last run generated, updated and pruned
+	results framework.Results `json:"-"`
 }
 
 type RouteConfig struct {
-	// FIXME: use yaml.NewYAMLOrJSONDecoder
-	Match string `yaml:"match ,omitempty" ,json:"match, omitempty"`
-	Vpn   bool   `yaml:"vpn ,omitempty" ,json:"vpn ,omitempty"`
+	// Match is a raw Traefik rule, kept as an escape hatch for the typed fields
+	Match      string `json:"match,omitempty"`
+	routeMatch `json:",inline"`
+	// Vpn restricts the route to a network profile, true for the default one or a profile name
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=""
+	Vpn vpnRef `json:"vpn,omitempty"`
+	// Hosts restricts the route to some of the config's hosts, all of them when empty
+	Hosts []string `json:"hosts,omitempty"`
+	// Backends split the route between Services by weight, the app's Service when empty
+	Backends []backendConfig `json:"backends,omitempty"`
+	// Mirrors get a copy of a percentage of the route's requests
+	Mirrors []mirrorConfig `json:"mirrors,omitempty"`
+	// Timeout bounds the request, a duration like 10s. Istio bounds the whole request, traefik
+	// only the wait for the response headers
+	Timeout string       `json:"timeout,omitempty"`
+	Retries *retryPolicy `json:"retries,omitempty"`
+	// BackendTLS connects to the backends over TLS
+	BackendTLS *backendTLSConfig `json:"backendTLS,omitempty"`
+	// ClientAuth requires clients to present a certificate signed by a CA
+	ClientAuth *clientAuthConfig `json:"clientAuth,omitempty"`
+	// Priority orders routes that match the same requests, higher first. Traefik's
+	// default is the length of the rule, so overlapping routes have to set it
+	// +kubebuilder:validation:Minimum=0
+	Priority int `json:"priority,omitempty"`
+	// httpPolicies are rendered as Traefik Middlewares on the route
+	httpPolicies `json:",inline"`
 }
 
-type functionConfig struct {
-	App    string        `yaml:"app" ,json:"app"`
-	Hosts  []string      `yaml:"hosts" ,json:"hosts"`
-	Grpc   bool          `yaml:"grpc ,omitempty" ,json:"grpc ,omitempty"`
-	Routes []RouteConfig `yaml:"routes" ,json:"routes"`
-}
-
-// change route to our own object
-// create inject routes file
-func FnConfigFromRNode(fnConfig *yaml.RNode) (*InjectRoutes, error) {
-	if fnConfig == nil {
-		return nil, errors.New("no functionConfig specified")
-	}
-
-	fn := &InjectRoutes{
-		fnConfig: fnConfig,
+// matcher validates the route's match, either the typed fields or the raw rule
+func (r RouteConfig) matcher() (matcher, error) {
+	if r.Match != "" {
+		if !r.routeMatch.isEmpty() {
+			return matcher{}, fmt.Errorf("match can not be combined with path, pathPrefix, headers, methods or query")
+		}
+		return rawMatcher(r.Match)
 	}
-	return fn, nil
+	return typedMatcher(r.routeMatch)
 }
 
-func (in *InjectRoutes) Filter(items []*yaml.RNode) ([]*yaml.RNode, error) {
-	fnConfig := in.fnConfig
-	//result := &injectResult{} // this is optional, mainly for debugging and observability purposes
+type networkingSpec struct {
+	App   string   `json:"app"`
+	Hosts []string `json:"hosts,omitempty"`
+	// Grpc is true for the defaults or the grpc block
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=""
+	Grpc   grpcConfig    `json:"grpc,omitempty"`
+	Routes []RouteConfig `json:"routes,omitempty"`
+	// TCPRoutes and UDPRoutes expose container ports of the app on Traefik entrypoints
+	TCPRoutes []tcpRouteConfig `json:"tcpRoutes,omitempty"`
+	UDPRoutes []udpRouteConfig `json:"udpRoutes,omitempty"`
+	// Output selects the ingress implementation, traefik when empty
+	// +kubebuilder:validation:Enum=traefik;gateway-api;ingress;istio
+	// +kubebuilder:default=traefik
+	Output  string         `json:"output,omitempty"`
+	Gateway *gatewayConfig `json:"gateway,omitempty"`
+	Ingress *ingressConfig `json:"ingress,omitempty"`
+	Istio   *istioConfig   `json:"istio,omitempty"`
+	// Certificate configures the issuer and layout of the hosts' certificates
+	Certificate *certificateConfig `json:"certificate,omitempty"`
+	// Redirects redirect http to https and hosts to their canonical host
+	Redirects *redirectsConfig `json:"redirects,omitempty"`
+	// Service configures the app's Service, which exposes the app container's named ports
+	Service *service.Config `json:"service,omitempty"`
+	// Internal exposes ports of the app to the VPC through an internal load balancer
+	Internal *internalConfig `json:"internal,omitempty"`
+	// DNS publishes the hosts through external-dns
+	DNS *dnsConfig `json:"dns,omitempty"`
+	// NetworkPolicy restricts traffic to the app to the declared apps, and its egress once it declares the apps it calls
+	NetworkPolicy *networkPolicyConfig `json:"networkPolicy,omitempty"`
+	// NetworkProfiles are named CIDR lists vpn routes can be restricted to
+	NetworkProfiles map[string][]string `json:"networkProfiles,omitempty"`
+	// DefaultNetworkProfile is the profile `vpn: true` binds to, vpn when empty
+	DefaultNetworkProfile string `json:"defaultNetworkProfile,omitempty"`
+}
 
-	// get the deploymeny information to generate services and certificates
-	deploymentName, httpsPort, grpcPort, err := getDeploymentData(items)
-	if err != nil {
-		return items, err
+// UnmarshalJSON rejects fields spec does not know, so misspelled ones are not ignored. The
+// legacy data is read leniently as it always was, its unknown fields are only warned about
+func (f *FunctionConfig) UnmarshalJSON(data []byte) error {
+	// the alias has no UnmarshalJSON, so this does not recurse
+	type config FunctionConfig
+	c := config{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
 	}
-
-	fn, err := unwrap(fnConfig)
-	if err != nil {
-		return items, err
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
 	}
-
-	// check for deployment with app label
-	foundDeployment := true
-	for _, item := range items {
-		_, err := item.GetMeta()
-		if err != nil {
-			return items, err
-		}
-
-		if fn.App == deploymentName {
-			foundDeployment = true
+	if spec, ok := fields["spec"]; ok {
+		c.Spec = nil
+		if err := decodeStrict(spec, &c.Spec); err != nil {
+			return err
 		}
 	}
-
-	if !foundDeployment {
-		return items, fmt.Errorf("could not find deployment with name: %s", fn.App)
+	if legacy, ok := fields["data"]; ok {
+		// data decoded already, so only unknown fields fail here
+		c.unknownData = decodeStrict(legacy, &networkingSpec{})
 	}
+	*f = FunctionConfig(c)
+	return nil
+}
 
-	// delete all the existing services, ingress and certificates
-	// FIXM: replace only the ones that this function creates
-	out := []*yaml.RNode{}
-
-	for _, resource := range items {
-		meta, err := resource.GetMeta()
-		if err != nil {
-			return items, err
-		}
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
 
-		if meta.Kind != "Service" && meta.Kind != "IngressRoute" && meta.Kind != "Certificate" {
-			out = append(out, resource)
-		}
+// Default moves the legacy data layout into spec and fills in the spec's defaults
+func (f *FunctionConfig) Default() error {
+	if f.Spec == nil && f.Data != nil {
+		f.Spec, f.Data, f.legacy = f.Data, nil, true
 	}
+	fn := f.Spec
+	if fn == nil {
+		return nil
+	}
+	if fn.Output == "" {
+		fn.Output = outputTraefik
+	}
+	if fn.Grpc.Enabled && fn.Grpc.InternalDomain == "" {
+		fn.Grpc.InternalDomain = defaultInternalDomain
+	}
+	if fn.NetworkPolicy != nil && fn.NetworkPolicy.IngressNamespace == "" {
+		fn.NetworkPolicy.IngressNamespace = defaultIngressNamespace
+	}
+	if fn.DNS != nil && fn.DNS.Mode == "" {
+		fn.DNS.Mode = dnsModeEndpoint
+	}
+	if fn.Redirects != nil && fn.Redirects.WebEntryPoint == "" {
+		fn.Redirects.WebEntryPoint = defaultWebEntryPoint
+	}
+	if fn.Redirects != nil && fn.Redirects.WebsecureEntryPoint == "" {
+		fn.Redirects.WebsecureEntryPoint = defaultWebsecureEntryPoint
+	}
+	return nil
+}
 
-	//if !fn.Grpc {
-	ingressRoute := traefik.IngressRoute{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       ingressRouteKind,
-			APIVersion: apiVersionNetworking,
-		},
-
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("%s-http", fn.App),
-		},
-
-		Spec: traefik.IngressRouteSpec{},
+func (f *FunctionConfig) Validate() error {
+	if f.Spec == nil {
+		return errors.New("spec is required")
 	}
+	if f.Data != nil {
+		return errors.New("spec and the deprecated data can not both be set")
+	}
+	return nil
+}
 
-	ingressRouteGrpc := traefik.IngressRoute{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       ingressRouteKind,
-			APIVersion: apiVersionNetworking,
-		},
+// Schema is read from the CRD controller-gen generates into crd/networking when the image is built
+func (f FunctionConfig) Schema() (*openapispec.Schema, error) {
+	crdFile, err := ioutil.ReadFile("crd/networking/krm_functionconfigs.yaml")
+	if err != nil {
+		return nil, kerrors.WrapPrefixf(err, "\n reading crd file")
+	}
+	schema, err := framework.SchemaFromFunctionDefinition(resid.NewGvk("krm", "networking", "FunctionConfig"), string(crdFile))
+	if err != nil {
+		return nil, kerrors.WrapPrefixf(err, "\n parsing networking crd")
+	}
+	return schema, nil
+}
 
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("%s-grpc", fn.App),
+// Filter is called from kio.Filter, results are appended to the resource list's Results.
+// A config read from data gets a deprecation warning next to whatever the run returned
+func (f *FunctionConfig) Filter(items []*yaml.RNode) ([]*yaml.RNode, error) {
+	out, err := f.filter(items)
+	if !f.legacy {
+		return out, err
+	}
+	results := framework.Results{
+		{
+			Message:  "data is deprecated, move the config to spec",
+			Severity: framework.Warning,
+			Field:    &framework.Field{Path: "data"},
 		},
-
-		Spec: traefik.IngressRouteSpec{},
 	}
+	if f.unknownData != nil {
+		results = append(results, &framework.Result{
+			Message:  fmt.Sprintf("data has fields the function does not know, they are ignored: %s", strings.TrimPrefix(f.unknownData.Error(), "json: ")),
+			Severity: framework.Warning,
+			Field:    &framework.Field{Path: "data"},
+		})
+	}
+	var r framework.Results
+	switch {
+	case errors.As(err, &r):
+		results = append(results, r...)
+	case err != nil:
+		results = append(results, &framework.Result{Message: err.Error(), Severity: framework.Error})
+	}
+	return out, results
+}
 
-	for _, inputRoute := range fn.Routes {
-		hosts := makeCopy(fn.Hosts)
-
-		exp, err := createMatchExpression(hosts, inputRoute.Match)
-		if err != nil {
-			return nil, err
-		}
-		// service
-		service := traefik.Service{}
-		service.LoadBalancerSpec.Name = deploymentName
-		service.LoadBalancerSpec.Port = intstr.FromInt(80)
-
-		newRoute := traefik.Route{
-			Match: exp,
-			Kind:  "Rule",
-			Services: []traefik.Service{
-				service,
-			},
-		}
+func (f *FunctionConfig) filter(items []*yaml.RNode) ([]*yaml.RNode, error) {
+	fn := f.Spec
 
-		if inputRoute.Vpn {
-			newRoute.Middlewares = append(newRoute.Middlewares, traefik.MiddlewareRef{
-				Name:      "vpn-only",
-				Namespace: "traefik",
-			})
-		}
-		ingressRoute.Spec.Routes = append(ingressRoute.Spec.Routes, newRoute)
+	// get the workload information to generate services and certificates
+	w, err := getWorkload(items, fn.App)
+	if err != nil {
+		return items, err
+	}
+	c, err := w.appContainer()
+	if err != nil {
+		return items, err
+	}
+	// the app's Service exposes every named port of the app container, the routes point at it
+	svc, err := service.Build(fn.App, w.Template.Labels, c.Ports, fn.Service)
+	if err != nil {
+		return nil, fieldError("spec.service", err)
+	}
+	httpPort := servicePort(svc, "https", "http")
+	grpcPort := servicePort(svc, "grpc")
+	var warnings framework.Results
+	if httpPort == 0 {
+		httpPort = defaultServicePort
+	}
+	if servicePort(svc, "https", "http") == 0 && routesToAppPort(fn) {
+		warnings = append(warnings, &framework.Result{
+			Message:     fmt.Sprintf("%s %s has no https or http container port, routes to Service %s use port %d, which it does not expose", w.Ref.Kind, w.Ref.Name, fn.App, httpPort),
+			Severity:    framework.Warning,
+			ResourceRef: w.Ref,
+			Field:       &framework.Field{Path: "spec.template.spec.containers"},
+		})
+	}
+	if len(fn.Hosts) == 0 {
+		warnings = append(warnings, &framework.Result{
+			Message:  "hosts is empty, routes match any host and no certificate is issued",
+			Severity: framework.Warning,
+			Field:    &framework.Field{Path: "spec.hosts"},
+		})
+	}
+	certificates, err := planCertificates(fn)
+	if err != nil {
+		return nil, fieldError("spec.certificate", err)
+	}
+	// routes point at the Service generated below, which is named after the app
+	model, err := buildRouteModel(fn, fn.App, httpPort, grpcPort, certificates)
+	if err != nil {
+		return nil, err
 	}
 
-	if fn.Grpc {
-		if grpcPort == 0 {
-			// grpc port not found on deployment
-			err = errors.New("grpc port not found on deployment")
-			return nil, err
-		}
-		// service
-		service := traefik.Service{}
-		service.LoadBalancerSpec.Name = deploymentName
-		service.LoadBalancerSpec.Port = intstr.FromInt(int(grpcPort))
-		service.LoadBalancerSpec.PassHostHeader = &[]bool{true}[0] //TODO: some hack to create a pointer to bool
-		service.LoadBalancerSpec.Scheme = "h2c"
-
-		newRoute := traefik.Route{
-			Match: fmt.Sprintf("Host(`%s.internal.bukukas.k8s`)", fn.App), // fake domain currently
-			Kind:  "Rule",
-			Services: []traefik.Service{
-				service,
-			},
-		}
-		ingressRouteGrpc.Spec.Routes = append(ingressRouteGrpc.Spec.Routes, newRoute)
+	if fn.Output == outputTraefik && usesSharedAllowlist(model.HTTP) {
+		warnings = append(warnings, &framework.Result{
+			Message:  "vpn routes use the shared Middleware traefik/vpn-only, which has to exist in the cluster, declare networkProfiles to generate the allowlist",
+			Severity: framework.Warning,
+			Field:    &framework.Field{Path: "spec.networkProfiles"},
+		})
 	}
 
-	ingressRouteNode, err := fnutils.MakeRNode(ingressRoute)
+	model.TCP, model.UDP, err = buildL4Routes(fn, w, fn.App, certificates)
 	if err != nil {
 		return nil, err
 	}
 
-	ingressRouteNodeGrpc, err := fnutils.MakeRNode(ingressRouteGrpc)
+	var routeNodes []*yaml.RNode
+	if fn.Output != outputTraefik && (len(model.TCP) > 0 || len(model.UDP) > 0) {
+		return nil, fmt.Errorf("tcpRoutes and udpRoutes are only supported by the traefik output")
+	}
+	if fn.Output != outputTraefik && fn.Redirects != nil {
+		return nil, fieldError("spec.redirects", fmt.Errorf("redirects are only supported by the traefik output"))
+	}
+	switch fn.Output {
+	case outputTraefik:
+		routeNodes, err = renderTraefik(model)
+		if err == nil {
+			var l4Nodes []*yaml.RNode
+			l4Nodes, err = renderTraefikL4(model)
+			routeNodes = append(routeNodes, l4Nodes...)
+		}
+	case outputGatewayAPI:
+		routeNodes, err = renderGatewayAPI(model, fn.Gateway)
+	case outputIngress:
+		routeNodes, err = renderIngress(model, fn.Ingress)
+	case outputIstio:
+		routeNodes, err = renderIstio(model, fn.Istio)
+	default:
+		err = fmt.Errorf("unknown output %q, expected one of %s", fn.Output, strings.Join([]string{outputTraefik, outputGatewayAPI, outputIngress, outputIstio}, ", "))
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	serviceNode, err := generateService(fn, httpsPort, grpcPort)
+	dnsNodes, err := generateDNS(fn, routeNodes)
 	if err != nil {
 		return nil, err
 	}
 
-	certificateNode, err := generateCertificate(fn)
+	serviceNode, err := fnutils.MakeRNode(svc)
 	if err != nil {
 		return nil, err
 	}
-
-	if fn.Grpc {
-		out = append(out, ingressRouteNode, ingressRouteNodeGrpc, serviceNode, certificateNode)
-	} else {
-		out = append(out, ingressRouteNode, serviceNode, certificateNode)
+	internalNodes, err := generateInternal(fn, svc)
+	if err != nil {
+		return nil, err
 	}
-	return out, nil
-}
 
-func unwrap(fnConfig *yaml.RNode) (*functionConfig, error) {
-	fn := &functionConfig{}
-	// unmarshall fnConfig into struct
-	data, err := fnConfig.GetFieldValue("data")
+	certificateNodes, err := generateCertificates(fn, certificates)
 	if err != nil {
 		return nil, err
 	}
-
-	fnYml, err := yml.Marshal(data)
+	caNodes, err := generateCACertificates(model.HTTP)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yml.Unmarshal(fnYml, &fn); err != nil {
+	exposed := len(model.HTTP) > 0 || model.GRPC != nil || len(model.TCP) > 0 || len(model.UDP) > 0
+	policyNodes, err := generateNetworkPolicies(fn, exposed)
+	if err != nil {
 		return nil, err
 	}
 
-	return fn, nil
-}
-
-func (i *InjectRoutes) Results() (framework.Results, error) {
-	var results framework.Results
-	if len(i.injectResults) == 0 {
-		results = append(results, &framework.Result{
-			Message: "no injections",
-		})
-		return results, nil
-	}
-	for _, injectResult := range i.injectResults {
-		var (
-			msg      string
-			severity framework.Severity
-			source   = fmt.Sprintf("%s %s", injectResult.Source.GetKind(), injectResult.Source.GetName())
-			route    = injectResult.Route
-		)
-		if injectResult.ErrorMsg != "" {
-			msg = fmt.Sprintf("%v failed to inject route to source %s: %s", route, source, injectResult.ErrorMsg)
-			severity = framework.Error
-		} else {
-			msg = fmt.Sprintf("injected route to source: %s", source)
-			severity = framework.Info
-		}
-
-		result := &framework.Result{
-			Message:  msg,
-			Severity: severity,
-		}
-
-		results = append(results, result)
+	generated := append(append(routeNodes, serviceNode), internalNodes...)
+	generated = append(generated, certificateNodes...)
+	generated = append(generated, caNodes...)
+	generated = append(generated, dnsNodes...)
+	generated = append(generated, policyNodes...)
+	fields := map[*yaml.RNode]string{serviceNode: "spec.app"}
+	for _, node := range routeNodes {
+		fields[node] = routeField(fn.App, node)
 	}
-	return results, nil
-}
-
-func getDeploymentData(items []*yaml.RNode) (string, int32, int32, error) {
-	deployment := v1.Deployment{}
-	for _, item := range items {
-		meta, err := item.GetMeta()
-		if err != nil {
-			return "", 0, 0, err
-		}
-		if meta.Kind == "Deployment" && meta.APIVersion == "apps/v1" {
-			dYaml, err := yml.Marshal(item)
-			if err != nil {
-				return "", 0, 0, err
-			}
-
-			if err := yml.Unmarshal(dYaml, &deployment); err != nil {
-				return "", 0, 0, err
-			}
+	for path, nodes := range map[string][]*yaml.RNode{
+		"spec.internal":      internalNodes,
+		"spec.hosts":         certificateNodes,
+		"spec.routes":        caNodes,
+		"spec.dns":           dnsNodes,
+		"spec.networkPolicy": policyNodes,
+	} {
+		for _, node := range nodes {
+			fields[node] = path
 		}
 	}
 
-	var httpsPort int32
-	var grpcPort int32
-
-	ports := deployment.Spec.Template.Spec.Containers[0].Ports
+	// replace only the resources that an earlier run of this config generated,
+	// so the function can be re-run and chained with other generators
+	owner := ownerOf(f)
+	if err := setOwner(generated, owner); err != nil {
+		return nil, err
+	}
+	out, adopted, err := adoptService(pruneOwned(items, owner), serviceNode)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConflicts(out, generated, owner); err != nil {
+		return nil, err
+	}
+	if err := checkRouteOverlaps(out, generated); err != nil {
+		return nil, err
+	}
 
-	for _, port := range ports {
-		if port.Name == "grpc" {
-			grpcPort = port.ContainerPort
-		}
-		if port.Name == "https" {
-			httpsPort = port.ContainerPort
+	var previous []*yaml.RNode
+	for _, item := range items {
+		if isOwnedBy(item, owner) {
+			previous = append(previous, item)
 		}
 	}
-	return deployment.Spec.Template.Spec.Containers[0].Name, httpsPort, grpcPort, nil
-}
-
-func generateService(fn *functionConfig, deploymentPort int32, grpcPort int32) (*yaml.RNode, error) {
-	// create a service object over here
-	service := corev1.Service{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Service",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fn.App,
-		},
-		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{
-				{
-					Port:       80,
-					Name:       "https",
-					TargetPort: intstr.IntOrString(intstr.FromInt(int(deploymentPort))),
-				},
-			},
-			Selector: map[string]string{
-				"app": fn.App,
-			},
-		},
+	if adopted != nil {
+		previous = append(previous, adopted)
 	}
-	if grpcPort != 0 {
-		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
-			Port:       80,
-			Name:       "grpc",
-			TargetPort: intstr.IntOrString(intstr.FromInt(int(grpcPort))),
-		})
+	results := warnings
+	for _, node := range generated {
+		result, err := generatedResult(node, fields[node], previous)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
 	}
-	// append service to the file
-	serviceNode, err := fnutils.MakeRNode(service)
+	pruned, err := prunedResults(previous, generated, owner)
 	if err != nil {
 		return nil, err
 	}
-	return serviceNode, nil
+	f.results = append(results, pruned...)
+	return append(out, generated...), nil
 }
 
-func generateCertificate(fn *functionConfig) (*yaml.RNode, error) {
+// Results are the generated, updated and pruned resources of the last run, with its warnings
+func (f *FunctionConfig) Results() (framework.Results, error) {
+	return f.results, nil
+}
 
-	certificate := cv1.Certificate{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Certificate",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fn.App,
-		},
-		Spec: cv1.CertificateSpec{
-			SecretName: fn.App + "-cert",
-			DNSNames:   fn.Hosts,
-			IssuerRef: cmmeta.ObjectReference{
-				Name: "letsencrypt",
-				Kind: "ClusterIssuer",
-			},
-		},
+// routesToAppPort tells if a route sends requests to the app Service's http port, which it
+// does for a backend or mirror of the app's Service without a port
+func routesToAppPort(fn *networkingSpec) bool {
+	for _, r := range fn.Routes {
+		if len(r.Backends) == 0 {
+			return true
+		}
+		for _, b := range r.Backends {
+			if b.Service == fn.App && b.Port == 0 {
+				return true
+			}
+		}
+		for _, m := range r.Mirrors {
+			if m.Service == fn.App && m.Port == 0 {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	certificateNode, err := fnutils.MakeRNode(certificate)
-	if err != nil {
-		return nil, err
+// servicePort returns the port of the first of names the Service exposes, 0 for none
+func servicePort(svc corev1.Service, names ...string) int32 {
+	for _, name := range names {
+		for _, p := range svc.Spec.Ports {
+			if p.Name == name {
+				return p.Port
+			}
+		}
 	}
-
-	return certificateNode, nil
+	return 0
 }
 
 func createMatchExpression(domains []string, expression string) (string, error) {
 	if expression == "" {
 		return "", fmt.Errorf("input string is empty")
 	}
+	// without hosts the route matches any host
+	if len(domains) == 0 {
+		return expression, nil
+	}
 	for i, domain := range domains {
 		domains[i] = fmt.Sprintf("Host(`%s`)", domain)
 	}
+	// && binds tighter than ||, so both sides need grouping to keep the hosts or'ed
 	newExpression := strings.Join(domains, " || ")
+	if len(domains) > 1 {
+		newExpression = fmt.Sprintf("(%s)", newExpression)
+	}
+	if strings.Contains(expression, "||") {
+		expression = fmt.Sprintf("(%s)", expression)
+	}
 	newExpression = newExpression + fmt.Sprintf(" && %s", expression)
 	return newExpression, nil
 }
@@ -0,0 +1,156 @@
+package networking
+
+import (
+	"fmt"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	defaultIngressNamespace = "traefik"
+	namespaceNameLabel      = "kubernetes.io/metadata.name"
+)
+
+// networkPolicyConfig declares the apps that may call the app and the apps it calls.
+// Everything else calling the app is denied, and once To is set so is everything else it calls
+type networkPolicyConfig struct {
+	// From are the apps that may call this app
+	From []appPeer `json:"from,omitempty"`
+	// To are the apps this app calls, egress is only restricted when it is set
+	To []appPeer `json:"to,omitempty"`
+	// IngressNamespace runs the ingress controller, which is allowed in when the config has routes.
+	// traefik when empty
+	IngressNamespace string `json:"ingressNamespace,omitempty"`
+}
+
+// appPeer selects pods by the app and part-of labels the workloads function sets,
+// in the app's namespace unless Namespace is set
+type appPeer struct {
+	App       string `json:"app,omitempty"`
+	PartOf    string `json:"partOf,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (p appPeer) networkPolicyPeer() (networkingv1.NetworkPolicyPeer, error) {
+	if p.App == "" && p.PartOf == "" {
+		return networkingv1.NetworkPolicyPeer{}, fmt.Errorf("a peer needs app or partOf")
+	}
+	labels := map[string]string{}
+	if p.App != "" {
+		labels["app"] = p.App
+	}
+	if p.PartOf != "" {
+		labels["part-of"] = p.PartOf
+	}
+	peer := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: labels},
+	}
+	if p.Namespace != "" {
+		peer.NamespaceSelector = namespaceSelector(p.Namespace)
+	}
+	return peer, nil
+}
+
+func namespaceSelector(namespace string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: namespace}}
+}
+
+// newNetworkPolicy selects the app's pods, restricting their egress as well when egress is set
+func newNetworkPolicy(name string, app string, egress bool) networkingv1.NetworkPolicy {
+	policyTypes := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if egress {
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkPolicy",
+			APIVersion: "networking.k8s.io/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			PolicyTypes: policyTypes,
+		},
+	}
+}
+
+// dnsEgress lets the app resolve names once egress is denied
+func dnsEgress() networkingv1.NetworkPolicyEgressRule {
+	rule := networkingv1.NetworkPolicyEgressRule{
+		To: []networkingv1.NetworkPolicyPeer{
+			{
+				NamespaceSelector: namespaceSelector("kube-system"),
+				PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"k8s-app": "kube-dns"}},
+			},
+		},
+	}
+	for _, protocol := range []corev1.Protocol{corev1.ProtocolUDP, corev1.ProtocolTCP} {
+		rule.Ports = append(rule.Ports, networkingv1.NetworkPolicyPort{
+			Protocol: utils.PointerTo(protocol),
+			Port:     utils.PointerTo(intstr.FromInt(53)),
+		})
+	}
+	return rule
+}
+
+// generateNetworkPolicies renders a default deny policy for the app and one allowing its
+// declared callers and dependencies, plus the ingress controller when exposed is set.
+// Egress is left alone unless the config declares dependencies
+func generateNetworkPolicies(fn *networkingSpec, exposed bool) ([]*yaml.RNode, error) {
+	conf := fn.NetworkPolicy
+	if conf == nil {
+		return nil, nil
+	}
+
+	egress := len(conf.To) > 0
+	deny := newNetworkPolicy(fmt.Sprintf("%s-default-deny", fn.App), fn.App, egress)
+
+	allow := newNetworkPolicy(fmt.Sprintf("%s-allow", fn.App), fn.App, egress)
+	for i, p := range conf.From {
+		peer, err := p.networkPolicyPeer()
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.networkPolicy.from[%d]", i), err)
+		}
+		allow.Spec.Ingress = append(allow.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{peer},
+		})
+	}
+	if exposed {
+		allow.Spec.Ingress = append(allow.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{{NamespaceSelector: namespaceSelector(conf.IngressNamespace)}},
+		})
+	}
+	for i, p := range conf.To {
+		peer, err := p.networkPolicyPeer()
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.networkPolicy.to[%d]", i), err)
+		}
+		allow.Spec.Egress = append(allow.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{peer},
+		})
+	}
+	if egress {
+		allow.Spec.Egress = append(allow.Spec.Egress, dnsEgress())
+	}
+
+	out := []*yaml.RNode{}
+	for _, policy := range []networkingv1.NetworkPolicy{deny, allow} {
+		node, err := fnutils.MakeRNode(policy)
+		if err != nil {
+			return nil, err
+		}
+		if err := node.PipeE(yaml.Clear("status")); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
@@ -0,0 +1,334 @@
+package networking
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// routeClaim is the part of the requests one route of an IngressRoute matches
+type routeClaim struct {
+	Ref   *yaml.ResourceIdentifier
+	Index int
+	// Hosts and EntryPoints are empty when the route takes any of them
+	Hosts       []string
+	EntryPoints []string
+	// Match is the rest of the rule in a canonical form, empty for a host only rule
+	Match string
+	// Typed is Match as typed fields, nil when the rule has parts they can not express
+	Typed    *routeMatch
+	Rule     string
+	Priority int
+}
+
+// priority is the priority Traefik orders the route by, the length of its rule by default
+func (c *routeClaim) priority() int {
+	if c.Priority != 0 {
+		return c.Priority
+	}
+	return len(c.Rule)
+}
+
+func (c *routeClaim) String() string {
+	return fmt.Sprintf("%s %s route %d", c.Ref.Kind, c.Ref.Name, c.Index)
+}
+
+// overlaps returns the host both claims are served on when they match the same requests
+// with the same priority, which Traefik then routes to either of them
+func (c *routeClaim) overlaps(other *routeClaim) (string, bool) {
+	if c.Match != other.Match || c.Priority != other.Priority {
+		return "", false
+	}
+	if _, ok := intersect(c.EntryPoints, other.EntryPoints); !ok {
+		return "", false
+	}
+	return intersect(c.Hosts, other.Hosts)
+}
+
+// shadows returns the host on which c takes every request other matches, so other is never
+// reached there. A narrower route winning over a broader one is how routing is meant to work,
+// and an identical one winning by priority is an override, so only broader routes count
+func (c *routeClaim) shadows(other *routeClaim) (string, bool) {
+	if c.priority() < other.priority() || !c.covers(other) || other.covers(c) {
+		return "", false
+	}
+	if _, ok := intersect(c.EntryPoints, other.EntryPoints); !ok {
+		return "", false
+	}
+	// other only loses the hosts c is served on
+	if len(c.Hosts) > 0 && len(other.Hosts) == 0 {
+		return "", false
+	}
+	return intersect(c.Hosts, other.Hosts)
+}
+
+// covers tells if c matches every request other matches, ignoring hosts
+func (c *routeClaim) covers(other *routeClaim) bool {
+	if c.Match == "" || c.Match == other.Match {
+		return true
+	}
+	if c.Typed == nil || other.Typed == nil {
+		return false
+	}
+	return c.Typed.covers(other.Typed)
+}
+
+// covers tells if m matches every request other matches
+func (m *routeMatch) covers(other *routeMatch) bool {
+	switch {
+	case m.Path != "":
+		if other.Path != m.Path {
+			return false
+		}
+	case m.PathPrefix != "":
+		path := other.Path
+		if path == "" {
+			path = other.PathPrefix
+		}
+		if !strings.HasPrefix(path, m.PathPrefix) {
+			return false
+		}
+	}
+	if len(m.Methods) > 0 {
+		if len(other.Methods) == 0 {
+			return false
+		}
+		methods := map[string]bool{}
+		for _, method := range m.Methods {
+			methods[method] = true
+		}
+		for _, method := range other.Methods {
+			if !methods[method] {
+				return false
+			}
+		}
+	}
+	for k, v := range m.Headers {
+		if value, ok := other.Headers[k]; !ok || value != v {
+			return false
+		}
+	}
+	for k, v := range m.Query {
+		if value, ok := other.Query[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// intersect returns the first value a and b share, where an empty list holds any value
+func intersect(a, b []string) (string, bool) {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return "", true
+	case len(a) == 0:
+		return b[0], true
+	case len(b) == 0:
+		return a[0], true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return x, true
+			}
+		}
+	}
+	return "", false
+}
+
+// routeClaims reads the claims of the IngressRoutes in nodes. Rules that do not parse are
+// skipped, hand-written routes are not ours to validate
+func routeClaims(nodes []*yaml.RNode) ([]*routeClaim, error) {
+	var claims []*routeClaim
+	for _, node := range nodes {
+		if node.GetKind() != ingressRouteKind {
+			continue
+		}
+		meta, err := node.GetMeta()
+		if err != nil {
+			return nil, err
+		}
+		data, err := node.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		ingressRoute := traefik.IngressRoute{}
+		if err := json.Unmarshal(data, &ingressRoute); err != nil {
+			return nil, fmt.Errorf("reading %s %s: %w", meta.Kind, meta.Name, err)
+		}
+		for i, r := range ingressRoute.Spec.Routes {
+			rule, err := parseRule(r.Match)
+			if err != nil {
+				continue
+			}
+			hosts, match, typed := splitHosts(rule)
+			claims = append(claims, &routeClaim{
+				Ref:         resourceRef(meta),
+				Index:       i,
+				Hosts:       hosts,
+				EntryPoints: ingressRoute.Spec.EntryPoints,
+				Match:       match,
+				Typed:       typed,
+				Rule:        r.Match,
+				Priority:    r.Priority,
+			})
+		}
+	}
+	return claims, nil
+}
+
+// splitHosts separates the hosts of a rule from the rest of it, which is also returned as typed
+// fields when they express it. Only hosts that are and'ed with the rest count, a rule like
+// Host(a) || Path(/b) is kept whole and takes any host
+func splitHosts(rule *ruleNode) ([]string, string, *routeMatch) {
+	var hosts []string
+	var rest []*ruleNode
+	for _, factor := range rule.conjunction() {
+		if h, ok := factor.hosts(); ok {
+			hosts = append(hosts, h...)
+		} else {
+			rest = append(rest, factor)
+		}
+	}
+	if len(rest) == 0 {
+		return hosts, "", &routeMatch{}
+	}
+
+	typed := routeMatch{}
+	converted := true
+	for _, factor := range rest {
+		converted = converted && factor.toTyped(&typed)
+	}
+	if converted {
+		sort.Strings(typed.Methods)
+		return hosts, typed.traefikRule(), &typed
+	}
+	var parts []string
+	for _, factor := range rest {
+		parts = append(parts, factor.String())
+	}
+	sort.Strings(parts)
+	return hosts, strings.Join(parts, " && "), nil
+}
+
+// conjunction flattens the && operands of the rule
+func (n *ruleNode) conjunction() []*ruleNode {
+	if n.Op != "&&" {
+		return []*ruleNode{n}
+	}
+	return append(n.Children[0].conjunction(), n.Children[1].conjunction()...)
+}
+
+// hosts returns the hosts of a Host matcher, or of several or'ed ones
+func (n *ruleNode) hosts() ([]string, bool) {
+	switch n.Op {
+	case "":
+		if n.Matcher != "Host" && n.Matcher != "HostHeader" {
+			return nil, false
+		}
+		var hosts []string
+		for _, h := range n.Args {
+			hosts = append(hosts, strings.ToLower(h))
+		}
+		return hosts, true
+	case "||":
+		left, ok := n.Children[0].hosts()
+		if !ok {
+			return nil, false
+		}
+		right, ok := n.Children[1].hosts()
+		if !ok {
+			return nil, false
+		}
+		return append(left, right...), true
+	}
+	return nil, false
+}
+
+func (n *ruleNode) String() string {
+	switch n.Op {
+	case "!":
+		return "!" + n.Children[0].String()
+	case "&&", "||":
+		return fmt.Sprintf("(%s %s %s)", n.Children[0], n.Op, n.Children[1])
+	}
+	return fmt.Sprintf("%s(%s)", n.Matcher, quoteArgs(n.Args))
+}
+
+// checkRouteOverlaps reports generated routes that match the same requests as another route
+// in the resource list. IngressRoutes of all namespaces share Traefik's routers, so
+// namespaces are not compared
+func checkRouteOverlaps(items []*yaml.RNode, generated []*yaml.RNode) error {
+	claims, err := routeClaims(generated)
+	if err != nil {
+		return err
+	}
+	others, err := routeClaims(items)
+	if err != nil {
+		return err
+	}
+
+	var results framework.Results
+	for i, c := range claims {
+		candidates := append(append([]*routeClaim{}, claims[i+1:]...), others...)
+		for _, other := range candidates {
+			if result := shadowResult(c, other); result != nil {
+				results = append(results, result)
+				continue
+			}
+			host, ok := c.overlaps(other)
+			if !ok {
+				continue
+			}
+			match := c.Match
+			if match == "" {
+				match = "all paths"
+			}
+			on := "on any host"
+			if host != "" {
+				on = "on host " + host
+			}
+			results = append(results, &framework.Result{
+				Message: fmt.Sprintf("%s overlaps %s, both match %s %s with priority %d, set a different priority on one of them",
+					c, other, match, on, c.Priority),
+				Severity:    framework.Error,
+				ResourceRef: other.Ref,
+			})
+		}
+	}
+	if len(results) > 0 {
+		return results
+	}
+	return nil
+}
+
+// shadowResult reports a route of c and other that the other one never lets through
+func shadowResult(c *routeClaim, other *routeClaim) *framework.Result {
+	winner, loser := c, other
+	host, ok := winner.shadows(loser)
+	if !ok {
+		winner, loser = other, c
+		if host, ok = winner.shadows(loser); !ok {
+			return nil
+		}
+	}
+	match := winner.Match
+	if match == "" {
+		match = "all paths"
+	}
+	on := "on any host"
+	if host != "" {
+		on = "on host " + host
+	}
+	return &framework.Result{
+		Message: fmt.Sprintf("%s shadows %s %s, it matches %s with priority %d and the narrower route has %d, give %s a higher priority",
+			winner, loser, on, match, winner.priority(), loser.priority(), loser),
+		Severity:    framework.Error,
+		ResourceRef: other.Ref,
+	}
+}
@@ -0,0 +1,121 @@
+package networking
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ownerAnnotation marks resources generated by a LummoNetworking config, the value
+// is <kind>/<namespace>/<name> of that config. Only resources carrying it are ever replaced
+const ownerAnnotation = fnutils.GeneratedByAnnotation
+
+func ownerOf(f *FunctionConfig) string {
+	return fnutils.OwnerKey(f.Kind, f.Namespace, f.Name)
+}
+
+// isOwnedBy also accepts the <kind>/<name> value earlier versions set, so their resources
+// are still replaced instead of conflicting
+func isOwnedBy(node *yaml.RNode, owner string) bool {
+	value := node.GetAnnotations()[ownerAnnotation]
+	if value == owner {
+		return true
+	}
+	parts := strings.Split(owner, "/")
+	return len(parts) == 3 && value == parts[0]+"/"+parts[2]
+}
+
+func setOwner(nodes []*yaml.RNode, owner string) error {
+	for _, node := range nodes {
+		if err := node.PipeE(yaml.SetAnnotation(ownerAnnotation, owner)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneOwned drops the resources a previous run of the same config generated
+func pruneOwned(items []*yaml.RNode, owner string) []*yaml.RNode {
+	out := []*yaml.RNode{}
+	for _, item := range items {
+		if !isOwnedBy(item, owner) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// adoptService takes over the app's Service when a generator that ran before, like workloads,
+// emitted it and marked it with ownerAnnotation. A Service without it was written by hand and
+// is left alone, so it conflicts with the generated one. The generated Service replaces the
+// adopted one and keeps the labels and annotations it does not set itself. It returns items
+// without the adopted Service, and that Service
+func adoptService(items []*yaml.RNode, svc *yaml.RNode) ([]*yaml.RNode, *yaml.RNode, error) {
+	svcMeta, err := svc.GetMeta()
+	if err != nil {
+		return nil, nil, err
+	}
+	out := []*yaml.RNode{}
+	var adopted *yaml.RNode
+	for _, item := range items {
+		meta, err := item.GetMeta()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, generated := meta.Annotations[ownerAnnotation]; adopted != nil || !generated || !sameResource(meta, svcMeta) {
+			out = append(out, item)
+			continue
+		}
+		adopted = item
+		labels, annotations := svc.GetLabels(), svc.GetAnnotations()
+		for k, v := range meta.Labels {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+		for k, v := range meta.Annotations {
+			if _, ok := annotations[k]; !ok {
+				annotations[k] = v
+			}
+		}
+		if err := svc.SetLabels(labels); err != nil {
+			return nil, nil, err
+		}
+		if err := svc.SetAnnotations(annotations); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, adopted, nil
+}
+
+// checkConflicts reports resources we did not generate that share an id with one we are about to
+func checkConflicts(items []*yaml.RNode, generated []*yaml.RNode, owner string) error {
+	var results framework.Results
+	for _, g := range generated {
+		gMeta, err := g.GetMeta()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			meta, err := item.GetMeta()
+			if err != nil {
+				return err
+			}
+			if !sameResource(meta, gMeta) {
+				continue
+			}
+			results = append(results, &framework.Result{
+				Message:     fmt.Sprintf("%s %s already exists and is not generated by %s", meta.Kind, meta.Name, owner),
+				Severity:    framework.Error,
+				ResourceRef: resourceRef(meta),
+			})
+		}
+	}
+	if len(results) > 0 {
+		return results
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package networking
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"github.com/traefik/traefik/v2/pkg/config/dynamic"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	defaultWebEntryPoint       = "web"
+	defaultWebsecureEntryPoint = "websecure"
+	// noopService is Traefik's built in service for routes that never reach a backend
+	noopService = "noop@internal"
+)
+
+// redirectsConfig answers requests with a redirect before they reach the routes. Setting it
+// pins the routes to the websecure entrypoint with the hosts' certificate
+type redirectsConfig struct {
+	// HTTPS redirects plain http on the web entrypoint to https
+	HTTPS bool `json:"https,omitempty"`
+	// Hosts redirect a host to its canonical one, keeping the path
+	Hosts []hostRedirect `json:"hosts,omitempty"`
+	// Permanent answers with 301 instead of 302
+	Permanent bool `json:"permanent,omitempty"`
+	// WebEntryPoint and WebsecureEntryPoint are the Traefik entrypoints for http and https,
+	// web and websecure when empty
+	WebEntryPoint       string `json:"webEntryPoint,omitempty"`
+	WebsecureEntryPoint string `json:"websecureEntryPoint,omitempty"`
+}
+
+type hostRedirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// redirectedHosts maps the hosts that are redirected to their canonical host
+func (r *redirectsConfig) redirectedHosts() map[string]string {
+	redirected := map[string]string{}
+	if r == nil {
+		return redirected
+	}
+	for _, h := range r.Hosts {
+		redirected[h.From] = h.To
+	}
+	return redirected
+}
+
+func validateRedirects(fn *networkingSpec, certificates []tlsCertificate) error {
+	conf := fn.Redirects
+	if !conf.HTTPS && len(conf.Hosts) == 0 {
+		return fmt.Errorf("redirects needs https or hosts")
+	}
+	if len(fn.Hosts) == 0 {
+		return fmt.Errorf("redirects needs the config's hosts")
+	}
+	declared := map[string]bool{}
+	for _, h := range fn.Hosts {
+		declared[h] = true
+	}
+	redirected := conf.redirectedHosts()
+	if len(redirected) != len(conf.Hosts) {
+		return fmt.Errorf("a host can only be redirected once")
+	}
+	var from, served []string
+	for _, h := range conf.Hosts {
+		if !declared[h.From] || !declared[h.To] {
+			return fmt.Errorf("redirect from %s to %s has to be between declared hosts %v", h.From, h.To, fn.Hosts)
+		}
+		if _, ok := redirected[h.To]; ok {
+			return fmt.Errorf("redirect from %s goes to %s, which is redirected itself", h.From, h.To)
+		}
+		from = append(from, h.From)
+	}
+	for _, h := range fn.Hosts {
+		if _, ok := redirected[h]; !ok {
+			served = append(served, h)
+		}
+	}
+	if len(served) == 0 {
+		return fmt.Errorf("all hosts are redirected")
+	}
+	for _, r := range fn.Routes {
+		for _, h := range r.Hosts {
+			if to, ok := redirected[h]; ok {
+				return fmt.Errorf("route host %s is redirected to %s", h, to)
+			}
+		}
+	}
+	// an IngressRoute references a single secret
+	for _, hosts := range [][]string{served, from} {
+		if len(hosts) > 0 && coveringCertificate(certificates, hosts) == nil {
+			return fmt.Errorf("hosts %v are not covered by a single certificate, which the pinned IngressRoutes need", hosts)
+		}
+	}
+	return nil
+}
+
+// coveringCertificate returns the certificate used for all hosts, nil if there is none
+func coveringCertificate(certificates []tlsCertificate, hosts []string) *tlsCertificate {
+	for i, c := range certificates {
+		covered := map[string]bool{}
+		for _, h := range c.Hosts {
+			covered[h] = true
+		}
+		all := true
+		for _, h := range hosts {
+			all = all && covered[h]
+		}
+		if all {
+			return &certificates[i]
+		}
+	}
+	return nil
+}
+
+func traefikTLS(certificates []tlsCertificate, hosts []string) (*traefik.TLS, error) {
+	c := coveringCertificate(certificates, hosts)
+	if c == nil {
+		return nil, fmt.Errorf("hosts %v are not covered by a single certificate", hosts)
+	}
+	return &traefik.TLS{SecretName: c.SecretName}, nil
+}
+
+// noopRoute matches match and only runs the middleware, the redirect answers before the
+// noop service is reached
+func noopRoute(match string, middleware string) traefik.Route {
+	return traefik.Route{
+		Match:       match,
+		Kind:        "Rule",
+		Middlewares: []traefik.MiddlewareRef{{Name: middleware}},
+		Services: []traefik.Service{
+			{LoadBalancerSpec: traefik.LoadBalancerSpec{Name: noopService, Kind: "TraefikService"}},
+		},
+	}
+}
+
+// renderTraefikRedirects renders the IngressRoute that redirects the web entrypoint to https
+// and the one that redirects hosts to their canonical host, with their Middlewares
+func renderTraefikRedirects(model *routeModel) ([]*yaml.RNode, error) {
+	conf := model.Redirects
+	var ingressRoutes []traefik.IngressRoute
+	var middlewares []traefik.Middleware
+
+	if conf.HTTPS {
+		name := fmt.Sprintf("%s-https-redirect", model.App)
+		middlewares = append(middlewares, newMiddleware(name, traefik.MiddlewareSpec{
+			RedirectScheme: &dynamic.RedirectScheme{
+				Scheme:    "https",
+				Permanent: conf.Permanent,
+			},
+		}))
+		web := newIngressRoute(fmt.Sprintf("%s-web", model.App))
+		web.Spec.EntryPoints = []string{conf.WebEntryPoint}
+		web.Spec.Routes = []traefik.Route{noopRoute(fmt.Sprintf("Host(%s)", quoteArgs(model.Hosts)), name)}
+		ingressRoutes = append(ingressRoutes, web)
+	}
+
+	if len(conf.Hosts) > 0 {
+		hostRedirects := newIngressRoute(fmt.Sprintf("%s-host-redirect", model.App))
+		hostRedirects.Spec.EntryPoints = []string{conf.WebsecureEntryPoint}
+		var from []string
+		for i, h := range conf.Hosts {
+			name := fmt.Sprintf("%s-host-redirect%d", model.App, i)
+			middlewares = append(middlewares, newMiddleware(name, traefik.MiddlewareSpec{
+				RedirectRegex: &dynamic.RedirectRegex{
+					Regex:       fmt.Sprintf("^https?://%s(:[0-9]+)?/(.*)", regexp.QuoteMeta(h.From)),
+					Replacement: fmt.Sprintf("https://%s/${2}", h.To),
+					Permanent:   conf.Permanent,
+				},
+			}))
+			hostRedirects.Spec.Routes = append(hostRedirects.Spec.Routes, noopRoute(fmt.Sprintf("Host(`%s`)", h.From), name))
+			from = append(from, h.From)
+		}
+		tls, err := traefikTLS(model.TLS, from)
+		if err != nil {
+			return nil, err
+		}
+		hostRedirects.Spec.TLS = tls
+		ingressRoutes = append(ingressRoutes, hostRedirects)
+	}
+
+	var out []*yaml.RNode
+	for _, r := range ingressRoutes {
+		node, err := fnutils.MakeRNode(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := clearTraefikServicePorts(node); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	for _, m := range middlewares {
+		node, err := fnutils.MakeRNode(m)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
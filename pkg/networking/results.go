@@ -0,0 +1,86 @@
+package networking
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// routeField is the config field a resource of the configured output was rendered from
+func routeField(app string, node *yaml.RNode) string {
+	name := node.GetName()
+	switch {
+	case node.GetKind() == "IngressRouteTCP":
+		return "spec.tcpRoutes"
+	case node.GetKind() == "IngressRouteUDP":
+		return "spec.udpRoutes"
+	case strings.HasPrefix(name, app+"-grpc"):
+		return "spec.grpc"
+	case name == app+"-web", strings.HasPrefix(name, app+"-https-redirect"), strings.HasPrefix(name, app+"-host-redirect"):
+		return "spec.redirects"
+	}
+	return "spec.routes"
+}
+
+func sameResource(a, b yaml.ResourceMeta) bool {
+	return a.Kind == b.Kind && a.Name == b.Name && a.Namespace == b.Namespace
+}
+
+// generatedResult reports a generated resource, updated when an earlier run of the config
+// generated it as well
+func generatedResult(node *yaml.RNode, field string, previous []*yaml.RNode) (*framework.Result, error) {
+	meta, err := node.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+	verb := "generated"
+	for _, p := range previous {
+		pMeta, err := p.GetMeta()
+		if err != nil {
+			return nil, err
+		}
+		if sameResource(meta, pMeta) {
+			verb = "updated"
+			break
+		}
+	}
+	return &framework.Result{
+		Message:     fmt.Sprintf("%s %s %s", verb, meta.Kind, meta.Name),
+		Severity:    framework.Info,
+		ResourceRef: resourceRef(meta),
+		Field:       &framework.Field{Path: field},
+	}, nil
+}
+
+// prunedResults reports the resources an earlier run of the config generated that this one
+// does not generate anymore
+func prunedResults(previous []*yaml.RNode, generated []*yaml.RNode, owner string) (framework.Results, error) {
+	var results framework.Results
+	for _, p := range previous {
+		meta, err := p.GetMeta()
+		if err != nil {
+			return nil, err
+		}
+		pruned := true
+		for _, g := range generated {
+			gMeta, err := g.GetMeta()
+			if err != nil {
+				return nil, err
+			}
+			if sameResource(meta, gMeta) {
+				pruned = false
+				break
+			}
+		}
+		if pruned {
+			results = append(results, &framework.Result{
+				Message:     fmt.Sprintf("pruned %s %s, %s no longer generates it", meta.Kind, meta.Name, owner),
+				Severity:    framework.Info,
+				ResourceRef: resourceRef(meta),
+			})
+		}
+	}
+	return results, nil
+}
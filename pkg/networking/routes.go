@@ -0,0 +1,188 @@
+package networking
+
+import (
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+)
+
+// routeModel is the backend independent description of what a LummoNetworking config exposes.
+// Filter builds it once and the configured output renders it into resources
+type routeModel struct {
+	App string
+	// Hosts are all hosts the routes are served on
+	Hosts []string
+	// TLS are the secrets that cover Hosts
+	TLS  []tlsCertificate
+	HTTP []httpRoute
+	GRPC *grpcRoute
+	TCP  []tcpRoute
+	UDP  []udpRoute
+	// Redirects pin the HTTP routes to https, only the traefik output renders them
+	Redirects *redirectsConfig
+}
+
+type httpRoute struct {
+	Hosts []string
+	Match matcher
+	// Allowlist restricts the route to a network profile, nil for public routes
+	Allowlist *allowlist
+	// Backends share the route's requests by weight, Mirrors get a copy of some of them
+	Backends []backendRef
+	Mirrors  []mirrorRef
+	// Timeout, Retries and BackendTLS apply to the requests sent to the backends
+	Timeout    string
+	Retries    *retryPolicy
+	BackendTLS *backendTLSConfig
+	// Policies only the traefik output can render
+	Policies httpPolicies
+	// ClientAuth requires client certificates, only the traefik output renders it
+	ClientAuth *clientAuthConfig
+	// Priority orders overlapping routes, 0 leaves it to the ingress
+	Priority int
+}
+
+// hasTransport reports whether the route sets a timeout, retries or backend TLS
+func (r *httpRoute) hasTransport() bool {
+	return r.Timeout != "" || r.Retries != nil || r.BackendTLS != nil
+}
+
+type grpcRoute struct {
+	// Host is the cluster internal host, served without TLS
+	Host string
+	// External are the partner facing hosts, served with TLS
+	External []grpcExternal
+	// Methods restrict the route, all methods when empty
+	Methods []grpcMethod
+	Backend backendRef
+}
+
+// backendRef points at a port of a kubernetes Service
+type backendRef struct {
+	Name string
+	Port int32
+	// Weight is only used between the backends of one route
+	Weight int32
+}
+
+func buildRouteModel(fn *networkingSpec, serviceName string, httpPort int32, grpcPort int32, certificates []tlsCertificate) (*routeModel, error) {
+	model := &routeModel{
+		App:   fn.App,
+		Hosts: makeCopy(fn.Hosts),
+		TLS:   certificates,
+	}
+	// redirected hosts are answered by the redirect and not served by the routes
+	served := fn.Hosts
+	if fn.Redirects != nil {
+		if err := validateRedirects(fn, certificates); err != nil {
+			return nil, fieldError("spec.redirects", err)
+		}
+		model.Redirects = fn.Redirects
+		redirected := fn.Redirects.redirectedHosts()
+		served = nil
+		for _, h := range fn.Hosts {
+			if _, ok := redirected[h]; !ok {
+				served = append(served, h)
+			}
+		}
+	}
+	if err := validateNetworkProfiles(fn); err != nil {
+		return nil, fieldError("spec.networkProfiles", err)
+	}
+
+	for i, inputRoute := range fn.Routes {
+		m, err := inputRoute.matcher()
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d]", i), err)
+		}
+		if err := inputRoute.httpPolicies.validate(m.Typed); err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d]", i), err)
+		}
+		if err := validateTimeouts(inputRoute.Timeout, inputRoute.Retries, inputRoute.BackendTLS); err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d]", i), err)
+		}
+		if inputRoute.ClientAuth != nil {
+			if err := inputRoute.ClientAuth.validate(); err != nil {
+				return nil, fieldError(fmt.Sprintf("spec.routes[%d].clientAuth", i), err)
+			}
+		}
+		if inputRoute.Priority < 0 {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d].priority", i), errors.New("priority can not be negative"))
+		}
+		allowlist, err := routeAllowlist(fn, inputRoute.Vpn)
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d].vpn", i), err)
+		}
+		backends, mirrors, err := routeBackends(serviceName, httpPort, inputRoute.Backends, inputRoute.Mirrors)
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d]", i), err)
+		}
+		hosts, err := routeHosts(served, inputRoute.Hosts)
+		if err != nil {
+			return nil, fieldError(fmt.Sprintf("spec.routes[%d].hosts", i), err)
+		}
+		model.HTTP = append(model.HTTP, httpRoute{
+			Hosts:      hosts,
+			Match:      m,
+			Allowlist:  allowlist,
+			Backends:   backends,
+			Mirrors:    mirrors,
+			Timeout:    inputRoute.Timeout,
+			Retries:    inputRoute.Retries,
+			BackendTLS: inputRoute.BackendTLS,
+			Policies:   inputRoute.httpPolicies,
+			ClientAuth: inputRoute.ClientAuth,
+			Priority:   inputRoute.Priority,
+		})
+	}
+
+	if err := validateClientAuth(model.HTTP); err != nil {
+		return nil, fieldError("spec.routes", err)
+	}
+
+	if fn.Grpc.Enabled {
+		if grpcPort == 0 {
+			// grpc port not found on deployment
+			return nil, errors.New("grpc port not found on deployment")
+		}
+		grpc, err := buildGRPCRoute(fn, backendRef{Name: serviceName, Port: grpcPort}, certificates)
+		if err != nil {
+			return nil, fieldError("spec.grpc", err)
+		}
+		model.GRPC = grpc
+	}
+	return model, nil
+}
+
+// fieldError reports err as an error Result on a field of the config
+func fieldError(path string, err error) error {
+	return framework.Results{
+		{
+			Message:  err.Error(),
+			Severity: framework.Error,
+			Field:    &framework.Field{Path: path},
+		},
+	}
+}
+
+// routeHosts returns the hosts a route is served on, which have to be declared on the config
+// so the certificate covers them
+func routeHosts(declared []string, hosts []string) ([]string, error) {
+	if len(hosts) == 0 {
+		return makeCopy(declared), nil
+	}
+	for _, h := range hosts {
+		found := false
+		for _, d := range declared {
+			if h == d {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("route host %s is not one of the declared hosts %v", h, declared)
+		}
+	}
+	return makeCopy(hosts), nil
+}
@@ -0,0 +1,26 @@
+package thirdparty
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ComputeAddress mirrors the parts of compute.cnrm.cloud.google.com/v1beta1 ComputeAddress
+// the function renders, config-connector is not a dependency
+type ComputeAddress struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ComputeAddressSpec `json:"spec"`
+}
+
+type ComputeAddressSpec struct {
+	Address       string              `json:"address,omitempty"`
+	AddressType   string              `json:"addressType"`
+	Description   string              `json:"description,omitempty"`
+	Location      string              `json:"location"`
+	SubnetworkRef *ComputeResourceRef `json:"subnetworkRef,omitempty"`
+}
+
+// ComputeResourceRef is a config-connector reference to a resource it does not manage
+type ComputeResourceRef struct {
+	External string `json:"external"`
+}
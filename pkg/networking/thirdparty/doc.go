@@ -0,0 +1,4 @@
+// Package thirdparty mirrors the parts of external APIs the networking function renders, for
+// the APIs whose Go types are not dependencies. They live outside pkg/networking, whose kinds
+// controller-gen turns into CRDs
+package thirdparty
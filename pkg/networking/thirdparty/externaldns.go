@@ -0,0 +1,23 @@
+package thirdparty
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DNSEndpoint mirrors externaldns.k8s.io/v1alpha1 DNSEndpoint, external-dns is not a dependency
+type DNSEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              DNSEndpointSpec `json:"spec"`
+}
+
+type DNSEndpointSpec struct {
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+type Endpoint struct {
+	DNSName    string   `json:"dnsName"`
+	Targets    []string `json:"targets"`
+	RecordType string   `json:"recordType"`
+	RecordTTL  int64    `json:"recordTTL,omitempty"`
+}
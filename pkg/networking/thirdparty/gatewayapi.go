@@ -0,0 +1,35 @@
+package thirdparty
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+// GRPCRoute mirrors gateway.networking.k8s.io/v1alpha2 GRPCRoute,
+// which the gateway-api version we depend on does not ship yet
+type GRPCRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              GRPCRouteSpec `json:"spec"`
+}
+
+type GRPCRouteSpec struct {
+	gatewayv1alpha2.CommonRouteSpec `json:",inline"`
+	Hostnames                       []gatewayv1alpha2.Hostname `json:"hostnames,omitempty"`
+	Rules                           []GRPCRouteRule            `json:"rules,omitempty"`
+}
+
+type GRPCRouteRule struct {
+	Matches     []GRPCRouteMatch             `json:"matches,omitempty"`
+	BackendRefs []gatewayv1alpha2.BackendRef `json:"backendRefs,omitempty"`
+}
+
+type GRPCRouteMatch struct {
+	Method *GRPCMethodMatch `json:"method,omitempty"`
+}
+
+type GRPCMethodMatch struct {
+	Type    *string `json:"type,omitempty"`
+	Service *string `json:"service,omitempty"`
+	Method  *string `json:"method,omitempty"`
+}
@@ -0,0 +1,181 @@
+package thirdparty
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types below mirror the parts of the networking.istio.io/v1beta1 and
+// security.istio.io/v1beta1 APIs the istio output renders, istio is not a dependency
+
+// IstioGateway is a networking.istio.io Gateway
+type IstioGateway struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              IstioGatewaySpec `json:"spec"`
+}
+
+type IstioGatewaySpec struct {
+	Selector map[string]string `json:"selector,omitempty"`
+	Servers  []IstioServer     `json:"servers"`
+}
+
+type IstioServer struct {
+	Port  IstioPort       `json:"port"`
+	Hosts []string        `json:"hosts"`
+	TLS   *IstioServerTLS `json:"tls,omitempty"`
+}
+
+type IstioPort struct {
+	Number   uint32 `json:"number"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+}
+
+type IstioServerTLS struct {
+	HTTPSRedirect  bool   `json:"httpsRedirect,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+	CredentialName string `json:"credentialName,omitempty"`
+}
+
+type VirtualService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              VirtualServiceSpec `json:"spec"`
+}
+
+type VirtualServiceSpec struct {
+	Hosts    []string         `json:"hosts"`
+	Gateways []string         `json:"gateways,omitempty"`
+	HTTP     []IstioHTTPRoute `json:"http,omitempty"`
+}
+
+type IstioHTTPRoute struct {
+	Name             string                  `json:"name,omitempty"`
+	Match            []IstioHTTPMatchRequest `json:"match,omitempty"`
+	Route            []IstioRouteDestination `json:"route"`
+	Mirror           *IstioDestination       `json:"mirror,omitempty"`
+	MirrorPercentage *IstioPercent           `json:"mirrorPercentage,omitempty"`
+	Timeout          string                  `json:"timeout,omitempty"`
+	Retries          *IstioHTTPRetry         `json:"retries,omitempty"`
+	Headers          *IstioHeaders           `json:"headers,omitempty"`
+	CorsPolicy       *IstioCorsPolicy        `json:"corsPolicy,omitempty"`
+}
+
+type IstioHTTPMatchRequest struct {
+	URI         *IstioStringMatch           `json:"uri,omitempty"`
+	Method      *IstioStringMatch           `json:"method,omitempty"`
+	Authority   *IstioStringMatch           `json:"authority,omitempty"`
+	Headers     map[string]IstioStringMatch `json:"headers,omitempty"`
+	QueryParams map[string]IstioStringMatch `json:"queryParams,omitempty"`
+}
+
+type IstioStringMatch struct {
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+type IstioRouteDestination struct {
+	Destination IstioDestination `json:"destination"`
+	Weight      int32            `json:"weight,omitempty"`
+}
+
+type IstioDestination struct {
+	Host string             `json:"host"`
+	Port *IstioPortSelector `json:"port,omitempty"`
+}
+
+type IstioPortSelector struct {
+	Number uint32 `json:"number"`
+}
+
+type IstioPercent struct {
+	Value float64 `json:"value"`
+}
+
+type IstioHTTPRetry struct {
+	Attempts      int32  `json:"attempts"`
+	PerTryTimeout string `json:"perTryTimeout,omitempty"`
+	RetryOn       string `json:"retryOn,omitempty"`
+}
+
+type IstioHeaders struct {
+	Request  *IstioHeaderOperations `json:"request,omitempty"`
+	Response *IstioHeaderOperations `json:"response,omitempty"`
+}
+
+type IstioHeaderOperations struct {
+	Set map[string]string `json:"set,omitempty"`
+}
+
+type IstioCorsPolicy struct {
+	AllowOrigins     []IstioStringMatch `json:"allowOrigins,omitempty"`
+	AllowMethods     []string           `json:"allowMethods,omitempty"`
+	AllowHeaders     []string           `json:"allowHeaders,omitempty"`
+	ExposeHeaders    []string           `json:"exposeHeaders,omitempty"`
+	MaxAge           string             `json:"maxAge,omitempty"`
+	AllowCredentials *bool              `json:"allowCredentials,omitempty"`
+}
+
+type DestinationRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              DestinationRuleSpec `json:"spec"`
+}
+
+type DestinationRuleSpec struct {
+	Host          string              `json:"host"`
+	TrafficPolicy *IstioTrafficPolicy `json:"trafficPolicy,omitempty"`
+}
+
+type IstioTrafficPolicy struct {
+	TLS *IstioClientTLS `json:"tls,omitempty"`
+}
+
+type IstioClientTLS struct {
+	Mode string `json:"mode"`
+}
+
+type AuthorizationPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              AuthorizationPolicySpec `json:"spec"`
+}
+
+type AuthorizationPolicySpec struct {
+	Selector *IstioWorkloadSelector `json:"selector,omitempty"`
+	Action   string                 `json:"action,omitempty"`
+	Rules    []IstioRule            `json:"rules,omitempty"`
+}
+
+type IstioWorkloadSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+type IstioRule struct {
+	From []IstioRuleFrom  `json:"from,omitempty"`
+	To   []IstioRuleTo    `json:"to,omitempty"`
+	When []IstioCondition `json:"when,omitempty"`
+}
+
+type IstioRuleFrom struct {
+	Source IstioSource `json:"source"`
+}
+
+type IstioSource struct {
+	NotRemoteIPBlocks []string `json:"notRemoteIpBlocks,omitempty"`
+}
+
+type IstioRuleTo struct {
+	Operation IstioOperation `json:"operation"`
+}
+
+type IstioOperation struct {
+	Hosts   []string `json:"hosts,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+type IstioCondition struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
@@ -0,0 +1,275 @@
+package networking
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	utils "github.com/bukukasio/krm-functions/pkg/common/utils"
+	traefik "github.com/traefik/traefik/v2/pkg/provider/kubernetes/crd/traefik/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	ingressRouteKind     = "IngressRoute"
+	apiVersionNetworking = "traefik.containo.us/v1alpha1"
+)
+
+func newIngressRoute(name string) traefik.IngressRoute {
+	return traefik.IngressRoute{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       ingressRouteKind,
+			APIVersion: apiVersionNetworking,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: traefik.IngressRouteSpec{},
+	}
+}
+
+// renderTraefik renders the route model as Traefik IngressRoutes
+func renderTraefik(model *routeModel) ([]*yaml.RNode, error) {
+	ingressRoute := newIngressRoute(fmt.Sprintf("%s-http", model.App))
+	if model.Redirects != nil {
+		redirected := model.Redirects.redirectedHosts()
+		var served []string
+		for _, h := range model.Hosts {
+			if _, ok := redirected[h]; !ok {
+				served = append(served, h)
+			}
+		}
+		tls, err := traefikTLS(model.TLS, served)
+		if err != nil {
+			return nil, err
+		}
+		ingressRoute.Spec.EntryPoints = []string{model.Redirects.WebsecureEntryPoint}
+		ingressRoute.Spec.TLS = tls
+	}
+	var middlewares []traefik.Middleware
+	allowlists := map[string]bool{}
+	var traefikServices []traefik.TraefikService
+	var transports []traefik.ServersTransport
+	// routes with client auth get an IngressRoute per CA, in order of first use, as the
+	// TLSOption is set on the IngressRoute's TLS
+	var cas []string
+	byCA := map[string]*traefik.IngressRoute{}
+	clientAuthHosts := map[string][]string{}
+
+	for i, r := range model.HTTP {
+		exp, err := createMatchExpression(makeCopy(r.Hosts), r.Match.Rule)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s-route%d", model.App, i)
+		var transportName, scheme string
+		if transport := traefikServersTransport(name, &r); transport != nil {
+			transportName = transport.Name
+			transports = append(transports, *transport)
+		}
+		if r.BackendTLS != nil {
+			scheme = "https"
+		}
+		service, services := traefikBackend(name, r.Backends, r.Mirrors, transportName, scheme)
+		traefikServices = append(traefikServices, services...)
+
+		newRoute := traefik.Route{
+			Match:    exp,
+			Kind:     "Rule",
+			Priority: r.Priority,
+			Services: []traefik.Service{
+				service,
+			},
+		}
+
+		if r.Allowlist != nil {
+			ref, m := traefikAllowlist(model.App, r.Allowlist)
+			newRoute.Middlewares = append(newRoute.Middlewares, ref)
+			if m != nil && !allowlists[m.Name] {
+				allowlists[m.Name] = true
+				middlewares = append(middlewares, *m)
+			}
+		}
+		// the route's own middlewares live next to the IngressRoute, so no namespace
+		routeMiddlewares := traefikMiddlewares(name, &r.Policies, r.Match.Typed)
+		// retrying goes last, so the other middlewares run once
+		retry, err := traefikRetry(name+"-retry", &r)
+		if err != nil {
+			return nil, err
+		}
+		if retry != nil {
+			routeMiddlewares = append(routeMiddlewares, *retry)
+		}
+		for _, m := range routeMiddlewares {
+			newRoute.Middlewares = append(newRoute.Middlewares, traefik.MiddlewareRef{Name: m.Name})
+			middlewares = append(middlewares, m)
+		}
+		if r.ClientAuth == nil {
+			ingressRoute.Spec.Routes = append(ingressRoute.Spec.Routes, newRoute)
+			continue
+		}
+		ca := r.ClientAuth.CASecret
+		mtls, ok := byCA[ca]
+		if !ok {
+			route := newIngressRoute(tlsOptionName(model.App, ca))
+			route.Spec.EntryPoints = ingressRoute.Spec.EntryPoints
+			mtls = &route
+			byCA[ca] = mtls
+			cas = append(cas, ca)
+		}
+		mtls.Spec.Routes = append(mtls.Spec.Routes, newRoute)
+		clientAuthHosts[ca] = append(clientAuthHosts[ca], r.Hosts...)
+	}
+
+	var ingressRoutes []*traefik.IngressRoute
+	if len(ingressRoute.Spec.Routes) > 0 || len(cas) == 0 {
+		ingressRoutes = append(ingressRoutes, &ingressRoute)
+	}
+	var tlsOptions []traefik.TLSOption
+	for _, ca := range cas {
+		mtls := byCA[ca]
+		tls, err := traefikTLS(model.TLS, clientAuthHosts[ca])
+		if err != nil {
+			return nil, err
+		}
+		option := traefikTLSOption(tlsOptionName(model.App, ca), ca)
+		tls.Options = &traefik.TLSOptionRef{Name: option.Name}
+		mtls.Spec.TLS = tls
+		tlsOptions = append(tlsOptions, option)
+		ingressRoutes = append(ingressRoutes, mtls)
+	}
+
+	var out []*yaml.RNode
+	for _, r := range ingressRoutes {
+		node, err := fnutils.MakeRNode(*r)
+		if err != nil {
+			return nil, err
+		}
+		if err := clearTraefikServicePorts(node); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	for _, m := range middlewares {
+		node, err := fnutils.MakeRNode(m)
+		if err != nil {
+			return nil, err
+		}
+		// initialInterval is not a pointer, so an unset one would be marshalled as 0
+		if err := node.PipeE(yaml.Lookup("spec", "retry"), yaml.Clear("initialInterval")); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	for _, s := range traefikServices {
+		node, err := fnutils.MakeRNode(s)
+		if err != nil {
+			return nil, err
+		}
+		if err := clearTraefikServicePorts(node); err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	for _, t := range transports {
+		node, err := fnutils.MakeRNode(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	for _, o := range tlsOptions {
+		node, err := fnutils.MakeRNode(o)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, node)
+	}
+	if model.Redirects != nil {
+		redirects, err := renderTraefikRedirects(model)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, redirects...)
+	}
+
+	if model.GRPC != nil {
+		grpcRoutes := []traefik.IngressRoute{}
+		internal, err := grpcIngressRoute(fmt.Sprintf("%s-grpc", model.App), []string{model.GRPC.Host}, model.GRPC)
+		if err != nil {
+			return nil, err
+		}
+		grpcRoutes = append(grpcRoutes, internal)
+
+		for i, e := range model.GRPC.External {
+			name := fmt.Sprintf("%s-grpc-external", model.App)
+			if i > 0 {
+				name = fmt.Sprintf("%s-%d", name, i)
+			}
+			external, err := grpcIngressRoute(name, e.Hosts, model.GRPC)
+			if err != nil {
+				return nil, err
+			}
+			external.Spec.TLS = &traefik.TLS{SecretName: e.TLSSecret}
+			grpcRoutes = append(grpcRoutes, external)
+		}
+
+		for _, r := range grpcRoutes {
+			node, err := fnutils.MakeRNode(r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, node)
+		}
+	}
+	return out, nil
+}
+
+// grpcIngressRoute routes the grpc methods on hosts to the h2c grpc backend
+func grpcIngressRoute(name string, hosts []string, g *grpcRoute) (traefik.IngressRoute, error) {
+	ingressRoute := newIngressRoute(name)
+	// service
+	service := traefik.Service{}
+	service.LoadBalancerSpec.Name = g.Backend.Name
+	service.LoadBalancerSpec.Port = intstr.FromInt(int(g.Backend.Port))
+	service.LoadBalancerSpec.PassHostHeader = utils.PointerTo(true)
+	service.LoadBalancerSpec.Scheme = "h2c"
+
+	var paths, prefixes []string
+	for _, m := range g.Methods {
+		if m.Method == "" {
+			prefixes = append(prefixes, m.path())
+		} else {
+			paths = append(paths, m.path())
+		}
+	}
+	var methods []string
+	if len(paths) > 0 {
+		methods = append(methods, fmt.Sprintf("Path(%s)", quoteArgs(paths)))
+	}
+	if len(prefixes) > 0 {
+		methods = append(methods, fmt.Sprintf("PathPrefix(%s)", quoteArgs(prefixes)))
+	}
+
+	var match string
+	if len(methods) == 0 {
+		match = fmt.Sprintf("Host(%s)", quoteArgs(hosts))
+	} else {
+		var err error
+		match, err = createMatchExpression(makeCopy(hosts), strings.Join(methods, " || "))
+		if err != nil {
+			return ingressRoute, err
+		}
+	}
+
+	ingressRoute.Spec.Routes = append(ingressRoute.Spec.Routes, traefik.Route{
+		Match: match,
+		Kind:  "Rule",
+		Services: []traefik.Service{
+			service,
+		},
+	})
+	return ingressRoute, nil
+}
@@ -0,0 +1,136 @@
+package networking
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+	yml "sigs.k8s.io/yaml"
+)
+
+// workloadKinds are the pod-bearing resources that can back a LummoNetworking app,
+// keyed by kind with the apiVersion we understand for each
+var workloadKinds = map[string]string{
+	"Deployment":  "apps/v1",
+	"StatefulSet": "apps/v1",
+	"Rollout":     "argoproj.io/v1alpha1",
+}
+
+// workload is the part of a Deployment, StatefulSet or Rollout that networking cares about
+type workload struct {
+	Ref      *yaml.ResourceIdentifier
+	App      string
+	Template corev1.PodTemplateSpec
+}
+
+func isWorkload(meta yaml.ResourceMeta) bool {
+	apiVersion, ok := workloadKinds[meta.Kind]
+	return ok && meta.APIVersion == apiVersion
+}
+
+func resourceRef(meta yaml.ResourceMeta) *yaml.ResourceIdentifier {
+	return &yaml.ResourceIdentifier{
+		TypeMeta: meta.TypeMeta,
+		NameMeta: meta.ObjectMeta.NameMeta,
+	}
+}
+
+// getWorkload finds the single workload whose app label matches app.
+// Finding none or more than one is reported as error Results
+func getWorkload(items []*yaml.RNode, app string) (*workload, error) {
+	var matches []*yaml.RNode
+	for _, item := range items {
+		meta, err := item.GetMeta()
+		if err != nil {
+			return nil, err
+		}
+		if isWorkload(meta) && meta.Labels["app"] == app {
+			matches = append(matches, item)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, framework.Results{
+			{
+				Message:  fmt.Sprintf("could not find a Deployment, StatefulSet or Rollout with label app=%s", app),
+				Severity: framework.Error,
+				Field:    &framework.Field{Path: "spec.app", CurrentValue: app},
+			},
+		}
+	}
+
+	if len(matches) > 1 {
+		var results framework.Results
+		for _, item := range matches {
+			meta, _ := item.GetMeta()
+			results = append(results, &framework.Result{
+				Message:     fmt.Sprintf("%d workloads have label app=%s, expected exactly one", len(matches), app),
+				Severity:    framework.Error,
+				ResourceRef: resourceRef(meta),
+			})
+		}
+		return nil, results
+	}
+
+	item := matches[0]
+	meta, _ := item.GetMeta()
+	template, err := item.Pipe(yaml.Lookup("spec", "template"))
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, framework.Results{
+			{
+				Message:     fmt.Sprintf("%s %s has no pod template", meta.Kind, meta.Name),
+				Severity:    framework.Error,
+				ResourceRef: resourceRef(meta),
+				Field:       &framework.Field{Path: "spec.template"},
+			},
+		}
+	}
+
+	w := &workload{
+		Ref: resourceRef(meta),
+		App: app,
+	}
+	tYaml, err := yml.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	if err := yml.Unmarshal(tYaml, &w.Template); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// appContainer returns the container named after the app, the others being sidecars
+func (w *workload) appContainer() (*corev1.Container, error) {
+	for i, c := range w.Template.Spec.Containers {
+		if c.Name == w.App {
+			return &w.Template.Spec.Containers[i], nil
+		}
+	}
+	return nil, framework.Results{
+		{
+			Message:     fmt.Sprintf("%s %s has no container named %s", w.Ref.Kind, w.Ref.Name, w.App),
+			Severity:    framework.Error,
+			ResourceRef: w.Ref,
+			Field:       &framework.Field{Path: "spec.template.spec.containers"},
+		},
+	}
+}
+
+// namedPort returns the container port called name of the app container
+func (w *workload) namedPort(name string) (corev1.ContainerPort, error) {
+	c, err := w.appContainer()
+	if err != nil {
+		return corev1.ContainerPort{}, err
+	}
+	for _, port := range c.Ports {
+		if port.Name == name {
+			return port, nil
+		}
+	}
+	return corev1.ContainerPort{}, fmt.Errorf("%s %s has no container port named %s", w.Ref.Kind, w.Ref.Name, name)
+}
@@ -7,10 +7,10 @@ import (
 	"io/ioutil"
 
 	"github.com/bukukasio/krm-functions/pkg/common/fnutils"
+	"github.com/bukukasio/krm-functions/pkg/common/service"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/kube-openapi/pkg/validation/spec"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"sigs.k8s.io/kustomize/kyaml/fn/framework"
@@ -30,12 +30,18 @@ type deploymentSpec struct {
 	Reloader bool         `json:"reloader,omitempty"`
 	Scaling  *scalingSpec `json:"scaling,omitempty"`
 	Strategy *strategy    `json:"strategy,omitempty"`
+	// Service configures the Service exposing the app container's named ports
+	Service *service.Config `json:"service,omitempty"`
 }
 
 type podSpec struct {
-	PartOf     string      `json:"part-of"`
-	App        string      `json:"app"`
-	Env        string      `json:"env,omitempty"`
+	PartOf string `json:"part-of"`
+	App    string `json:"app"`
+	Env    string `json:"env,omitempty"`
+	// Containers are corev1.Containers or the names of LummoContainers. A container takes its
+	// name and required fields from its base, so the function validates them once resolved
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
 	Containers []container `json:"containers,omitempty"`
 }
 
@@ -103,12 +109,9 @@ func (s secret) envFromSecret() corev1.EnvFromSource {
 type container struct {
 	corev1.Container `json:",inline"`
 	// this is docker compose-ish
-	// if these fields are populated, they augment the container
-	// if they are not populated, the container is used as is
-	// if they are populated, the container is used as a base
-	// and the fields are applied on top
-	// if they are populated, the container is used as a base
-	// and the fields are applied on top
+	// if base is set, the LummoContainer it names is used as a base
+	// and the fields of the container are deep merged on top
+	Base    string   `json:"base,omitempty"`
 	Configs []config `json:"configs"`
 	Secrets []secret `json:"secrets"`
 	Grpc    grpc     `json:"grpc,omitempty"`
@@ -116,6 +119,9 @@ type container struct {
 
 	// Complicated because of PVC stuff and not worth doing
 	//Volumes []string `json:"volumes"`
+
+	// raw holds the fields as configured, to merge them over the base
+	raw map[string]interface{}
 }
 
 func (c *container) GetContainer() corev1.Container {
@@ -137,16 +143,29 @@ func (c *container) GetContainer() corev1.Container {
 }
 
 func (fnConfig *FunctionConfig) Filter(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
-	out := []*kyaml.RNode{}
+	if err := fnConfig.Spec.resolveContainers(nodes); err != nil {
+		return nil, err
+	}
+	out, err := passThrough(nodes)
+	if err != nil {
+		return nil, err
+	}
 	if fnConfig.Kind == "LummoDeployment" {
 		deployment := makeDeployment(*fnConfig)
-		service := makeService(deployment)
+		svc, err := makeService(deployment, fnConfig.Spec.Service)
+		if err != nil {
+			return nil, err
+		}
+		// marked as generated, so networking adopts the Service instead of reporting a conflict
+		svc.Annotations = map[string]string{
+			fnutils.GeneratedByAnnotation: fnutils.OwnerKey(fnConfig.Kind, fnConfig.Namespace, fnConfig.Name),
+		}
 		if d, err := fnutils.MakeRNode(deployment); err != nil {
 			return nil, err
 		} else {
 			out = append(out, d)
 		}
-		if s, err := fnutils.MakeRNode(service); err != nil {
+		if s, err := fnutils.MakeRNode(svc); err != nil {
 			return nil, err
 		} else {
 			out = append(out, s)
@@ -261,38 +280,14 @@ func makeDeployment(conf FunctionConfig) appsv1.Deployment {
 	return *d
 }
 
-func makeService(d appsv1.Deployment) corev1.Service {
-	s := corev1.Service{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Service",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: d.ObjectMeta.Labels["app"],
-			Labels: map[string]string{
-				"part-of": d.ObjectMeta.Labels["part-of"],
-				"app":     d.ObjectMeta.Labels["app"],
-			},
-		},
-	}
-	s.Spec.Selector = d.Spec.Selector.MatchLabels
-	// actually should happen for all containers? One service per deployment or container? How do services scale
-	// but ingress is probably only needed for app cotainer
+// makeService exposes the app container's named ports, the same way networking does
+func makeService(d appsv1.Deployment, conf *service.Config) (corev1.Service, error) {
+	// ingress is probably only needed for the app container, so only its ports are exposed
 	ac, err := getAppContainer(d)
-
 	if err != nil {
-		// TODO validation error
-		panic(err)
-	}
-
-	for _, p := range ac.Ports {
-		s.Spec.Ports = append(s.Spec.Ports, corev1.ServicePort{
-			Name:       p.Name,
-			Port:       p.ContainerPort,
-			TargetPort: intstr.FromInt(int(p.ContainerPort)),
-		})
+		return corev1.Service{}, err
 	}
-	return s
+	return service.Build(d.ObjectMeta.Labels["app"], d.Spec.Template.Labels, ac.Ports, conf)
 }
 
 func (a FunctionConfig) Schema() (*spec.Schema, error) {
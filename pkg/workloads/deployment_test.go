@@ -0,0 +1,125 @@
+package workloads
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// TestService checks the ports of the Service a LummoDeployment generates for its app container
+func TestService(t *testing.T) {
+	var tests = []struct {
+		name     string
+		spec     string
+		expected string
+		errorMsg string
+	}{
+		{
+			name: "http port keeps its container port",
+			spec: `
+containers:
+- name: foobar
+  image: foobar:1
+  http:
+    port: 2000`,
+			expected: `
+- name: http
+  port: 2000
+  protocol: TCP
+  targetPort: 2000`,
+		},
+		{
+			name: "http and https ports",
+			spec: `
+containers:
+- name: foobar
+  image: foobar:1
+  ports:
+  - name: https
+    containerPort: 8443
+  - name: http
+    containerPort: 8080`,
+			expected: `
+- name: https
+  port: 8443
+  targetPort: 8443
+- name: http
+  port: 8080
+  targetPort: 8080`,
+		},
+		{
+			name: "service ports override the container port",
+			spec: `
+containers:
+- name: foobar
+  image: foobar:1
+  http:
+    port: 2000
+service:
+  ports:
+  - name: http
+    port: 80`,
+			expected: `
+- name: http
+  port: 80
+  protocol: TCP
+  targetPort: 2000`,
+		},
+		{
+			name: "single unnamed port",
+			spec: `
+containers:
+- name: foobar
+  image: foobar:1
+  ports:
+  - containerPort: 8080`,
+			expected: `
+- port: 8080
+  targetPort: 8080`,
+		},
+		{
+			name: "unnamed port next to others",
+			spec: `
+containers:
+- name: foobar
+  image: foobar:1
+  ports:
+  - containerPort: 8080
+  grpc:
+    port: 5000`,
+			errorMsg: "container port 8080 has no name, a Service with several ports needs them named",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := FunctionConfig{}
+			config.Kind = "LummoDeployment"
+			if !assert.NoError(t, k8syaml.Unmarshal([]byte("part-of: foo\napp: foobar\n"+test.spec), &config.Spec)) {
+				return
+			}
+			out, err := config.Filter(nil)
+			if test.errorMsg != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.errorMsg, err.Error())
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			var svc corev1.Service
+			for _, node := range out {
+				if node.GetKind() == "Service" {
+					assert.NoError(t, k8syaml.Unmarshal([]byte(node.MustString()), &svc))
+				}
+			}
+			expected := []corev1.ServicePort{}
+			if !assert.NoError(t, k8syaml.Unmarshal([]byte(test.expected), &expected)) {
+				return
+			}
+			assert.Equal(t, expected, svc.Spec.Ports)
+		})
+	}
+}
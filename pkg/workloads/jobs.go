@@ -107,7 +107,13 @@ func makeJob(jobConfig JobFunctionConfig) batchv1.Job {
 }
 
 func (fnConfig *JobFunctionConfig) Filter(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
-	out := []*kyaml.RNode{}
+	if err := fnConfig.Spec.resolveContainers(nodes); err != nil {
+		return nil, err
+	}
+	out, err := passThrough(nodes)
+	if err != nil {
+		return nil, err
+	}
 	if fnConfig.Kind == "LummoJob" {
 		job := makeJob(*fnConfig)
 		if d, err := fnutils.MakeRNode(job); err != nil {
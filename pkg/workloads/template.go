@@ -0,0 +1,189 @@
+package workloads
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/kio/filters"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/kustomize/kyaml/yaml/merge2"
+	"sigs.k8s.io/kustomize/kyaml/yaml/walk"
+)
+
+// containerTemplateKind is the kind of the container templates containers extend with base
+const containerTemplateKind = "LummoContainer"
+
+// UnmarshalJSON keeps the fields the container sets, they are merged over its base. A bare
+// string is the name of a template used as is
+func (c *container) UnmarshalJSON(data []byte) error {
+	var base string
+	if err := json.Unmarshal(data, &base); err == nil {
+		*c = container{Base: base, raw: map[string]interface{}{"base": base}}
+		return nil
+	}
+	type plain container
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = container(p)
+	return json.Unmarshal(data, &c.raw)
+}
+
+// containerTemplates indexes the LummoContainer resources by name
+func containerTemplates(nodes []*kyaml.RNode) (map[string]*kyaml.RNode, error) {
+	templates := map[string]*kyaml.RNode{}
+	for _, n := range nodes {
+		if n.GetKind() != containerTemplateKind {
+			continue
+		}
+		name := n.GetName()
+		if _, ok := templates[name]; ok {
+			return nil, fmt.Errorf("%s %s is defined twice", containerTemplateKind, name)
+		}
+		spec := n.Field("spec")
+		if spec == nil {
+			templates[name] = kyaml.NewMapRNode(nil)
+			continue
+		}
+		templates[name] = spec.Value
+	}
+	return templates, nil
+}
+
+// passThrough returns the input items for the function's output. Templates only reach the
+// function as input of a kustomize transformer, which has to return the resources it is given,
+// so they are marked as local config, which kustomize leaves out of its output
+func passThrough(nodes []*kyaml.RNode) ([]*kyaml.RNode, error) {
+	for _, n := range nodes {
+		if n.GetKind() != containerTemplateKind {
+			continue
+		}
+		if err := n.PipeE(kyaml.SetAnnotation(filters.LocalConfigAnnotation, "true")); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// resolveTemplate merges the template called name over the templates it inherits from
+func resolveTemplate(name string, templates map[string]*kyaml.RNode, chain []string) (*kyaml.RNode, error) {
+	chain = append(chain, name)
+	for _, n := range chain[:len(chain)-1] {
+		if n == name {
+			return nil, fmt.Errorf("%s %s inherits from itself: %s", containerTemplateKind, name, strings.Join(chain, " -> "))
+		}
+	}
+	template, ok := templates[name]
+	if !ok {
+		if len(chain) == 1 {
+			return nil, fmt.Errorf("%s %s does not exist", containerTemplateKind, name)
+		}
+		return nil, fmt.Errorf("%s %s does not exist, %s uses it as base", containerTemplateKind, name, chain[len(chain)-2])
+	}
+	base, err := template.Pipe(kyaml.Get("base"))
+	if err != nil {
+		return nil, err
+	}
+	if base == nil || base.YNode().Value == "" {
+		return template.Copy(), nil
+	}
+	parent, err := resolveTemplate(base.YNode().Value, templates, chain)
+	if err != nil {
+		return nil, err
+	}
+	return mergeContainer(parent, template)
+}
+
+// mergeContainer deep merges override over base: maps are merged, lists of objects are
+// merged by name and other lists and scalars are replaced
+func mergeContainer(base *kyaml.RNode, override *kyaml.RNode) (*kyaml.RNode, error) {
+	merged, err := walk.Walker{
+		Sources:               []*kyaml.RNode{base.Copy(), override.Copy()},
+		Visitor:               merge2.Merger{},
+		InferAssociativeLists: true,
+		MergeOptions:          kyaml.MergeOptions{ListIncreaseDirection: kyaml.MergeOptionsListAppend},
+	}.Walk()
+	if err != nil {
+		return nil, err
+	}
+	if err := merged.PipeE(kyaml.Clear("base")); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// resolve replaces a container that has a base with its template, merged with the fields the
+// container sets. The container is named after the template when neither names it
+func (c *container) resolve(templates map[string]*kyaml.RNode) error {
+	if c.Base == "" {
+		return nil
+	}
+	base, err := resolveTemplate(c.Base, templates, nil)
+	if err != nil {
+		return err
+	}
+	override, err := kyaml.FromMap(c.raw)
+	if err != nil {
+		return err
+	}
+	merged, err := mergeContainer(base, override)
+	if err != nil {
+		return err
+	}
+	data, err := merged.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	name := c.Base
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		c.Name = name
+	}
+	c.Base = ""
+	return nil
+}
+
+// validate checks a resolved container. The schema leaves containers to the function, as a
+// container can be a template name, so it rejects unknown fields and needs a name and an image
+func (c *container) validate() error {
+	data, err := json.Marshal(c.raw)
+	if err != nil {
+		return err
+	}
+	type plain container
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&plain{}); err != nil {
+		return fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if c.Name == "" {
+		return fmt.Errorf("container has no name")
+	}
+	if c.Image == "" {
+		return fmt.Errorf("container %s has no image", c.Name)
+	}
+	return nil
+}
+
+// resolveContainers resolves the containers of the spec against the LummoContainer resources
+// and validates them
+func (s *podSpec) resolveContainers(nodes []*kyaml.RNode) error {
+	templates, err := containerTemplates(nodes)
+	if err != nil {
+		return err
+	}
+	for i := range s.Containers {
+		if err := s.Containers[i].resolve(templates); err != nil {
+			return fmt.Errorf("spec.containers[%d]: %w", i, err)
+		}
+		if err := s.Containers[i].validate(); err != nil {
+			return fmt.Errorf("spec.containers[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+package workloads
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/kustomize/kyaml/fn/framework"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// TestMain runs the tests from the repository root, the functions read the CRDs make crd
+// generates from the working directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestResolveContainers(t *testing.T) {
+	var tests = []struct {
+		name       string
+		templates  string
+		containers string
+		expected   string
+		errorMsg   string
+	}{
+		{
+			name: "bare string uses the template as is",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1
+  command: ["python", "server.py"]`,
+			containers: `
+- foobar`,
+			expected: `
+- name: foobar
+  image: foobar:1
+  command: ["python", "server.py"]`,
+		},
+		{
+			name: "nameless base is named after the template",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1
+  command: ["python", "server.py"]`,
+			containers: `
+- base: foobar
+  command: ["python", "batch.py"]`,
+			expected: `
+- name: foobar
+  image: foobar:1
+  command: ["python", "batch.py"]`,
+		},
+		{
+			name: "container name wins over the template name",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  name: api
+  image: foobar:1`,
+			containers: `
+- base: foobar
+  name: worker`,
+			expected: `
+- name: worker
+  image: foobar:1`,
+		},
+		{
+			name: "maps and name keyed lists are merged, scalars and other lists replaced",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1
+  command: ["python", "server.py"]
+  configs:
+  - foobar-api
+  env:
+  - name: A
+    value: "1"
+  - name: B
+    value: "2"
+  ports:
+  - name: http
+    containerPort: 8000
+  resources:
+    limits:
+      cpu: "1"
+      memory: 1Gi`,
+			containers: `
+- base: foobar
+  image: foobar:2
+  command: ["python", "batch.py"]
+  configs:
+  - foobar-batch
+  env:
+  - name: B
+    value: "3"
+  - name: C
+    value: "4"
+  ports:
+  - name: http
+    containerPort: 9000
+  - name: metrics
+    containerPort: 9090
+  resources:
+    limits:
+      memory: 2Gi`,
+			expected: `
+- name: foobar
+  image: foobar:2
+  command: ["python", "batch.py"]
+  envFrom:
+  - configMapRef:
+      name: foobar-batch
+  env:
+  - name: A
+    value: "1"
+  - name: B
+    value: "3"
+  - name: C
+    value: "4"
+  ports:
+  - name: http
+    containerPort: 9000
+  - name: metrics
+    containerPort: 9090
+  resources:
+    limits:
+      cpu: "1"
+      memory: 2Gi`,
+		},
+		{
+			name: "templates inherit over several levels",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: base
+spec:
+  image: foobar:1
+  env:
+  - name: LEVEL
+    value: base
+  - name: BASE
+    value: "1"
+---
+kind: LummoContainer
+metadata:
+  name: api
+spec:
+  base: base
+  command: ["python", "server.py"]
+  env:
+  - name: LEVEL
+    value: api
+---
+kind: LummoContainer
+metadata:
+  name: api-debug
+spec:
+  base: api
+  env:
+  - name: LEVEL
+    value: api-debug
+  - name: DEBUG
+    value: "1"`,
+			containers: `
+- api-debug
+- base: api
+  name: api`,
+			expected: `
+- name: api-debug
+  image: foobar:1
+  command: ["python", "server.py"]
+  env:
+  - name: LEVEL
+    value: api-debug
+  - name: BASE
+    value: "1"
+  - name: DEBUG
+    value: "1"
+- name: api
+  image: foobar:1
+  command: ["python", "server.py"]
+  env:
+  - name: LEVEL
+    value: api
+  - name: BASE
+    value: "1"`,
+		},
+		{
+			name: "container without base is kept",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1`,
+			containers: `
+- name: whatever
+  image: blah:latest`,
+			expected: `
+- name: whatever
+  image: blah:latest`,
+		},
+		{
+			name: "templates inheriting from each other",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: a
+spec:
+  base: b
+---
+kind: LummoContainer
+metadata:
+  name: b
+spec:
+  base: a`,
+			containers: `
+- name: main
+  image: main:1
+- a`,
+			errorMsg: "spec.containers[1]: LummoContainer a inherits from itself: a -> b -> a",
+		},
+		{
+			name:       "missing template",
+			containers: `- foobar`,
+			errorMsg:   "spec.containers[0]: LummoContainer foobar does not exist",
+		},
+		{
+			name: "missing base of a template",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  base: gone`,
+			containers: `- base: foobar`,
+			errorMsg:   "spec.containers[0]: LummoContainer gone does not exist, foobar uses it as base",
+		},
+		{
+			name: "unknown container field",
+			containers: `
+- name: foobar
+  imagee: foobar:1`,
+			errorMsg: "spec.containers[0]: unknown field \"imagee\"",
+		},
+		{
+			name: "unknown field in a template",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1
+  comand: ["python", "server.py"]`,
+			containers: `- foobar`,
+			errorMsg:   "spec.containers[0]: unknown field \"comand\"",
+		},
+		{
+			name: "no image once resolved",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  command: ["python", "server.py"]`,
+			containers: `- foobar`,
+			errorMsg:   "spec.containers[0]: container foobar has no image",
+		},
+		{
+			name: "no name",
+			containers: `
+- image: foobar:1`,
+			errorMsg: "spec.containers[0]: container has no name",
+		},
+		{
+			name: "template defined twice",
+			templates: `
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:1
+---
+kind: LummoContainer
+metadata:
+  name: foobar
+spec:
+  image: foobar:2`,
+			containers: `- foobar`,
+			errorMsg:   "LummoContainer foobar is defined twice",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := kio.FromBytes([]byte(test.templates))
+			if !assert.NoError(t, err) {
+				return
+			}
+			spec := podSpec{}
+			if !assert.NoError(t, k8syaml.Unmarshal([]byte("containers:\n"+test.containers), &spec)) {
+				return
+			}
+			err = spec.resolveContainers(nodes)
+			if test.errorMsg != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.errorMsg, err.Error())
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, c := range spec.Containers {
+				assert.Empty(t, c.Base)
+			}
+			expected := []corev1.Container{}
+			if !assert.NoError(t, k8syaml.Unmarshal([]byte(test.expected), &expected)) {
+				return
+			}
+			assert.Equal(t, expected, spec.GetContainers())
+		})
+	}
+}
+
+// TestResolveTemplate checks that base is stripped from resolved templates, the merged
+// container is not a template anymore
+func TestResolveTemplate(t *testing.T) {
+	nodes, err := kio.FromBytes([]byte(`
+kind: LummoContainer
+metadata:
+  name: base
+spec:
+  image: foobar:1
+---
+kind: LummoContainer
+metadata:
+  name: api
+spec:
+  base: base
+  command: ["python", "server.py"]
+---
+kind: LummoContainer
+metadata:
+  name: api-debug
+spec:
+  base: api
+  args: ["--debug"]`))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	templates, err := containerTemplates(nodes)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for _, name := range []string{"base", "api", "api-debug"} {
+		resolved, err := resolveTemplate(name, templates, nil)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Nil(t, resolved.Field("base"), name)
+		assert.Equal(t, "foobar:1", resolved.Field("image").Value.YNode().Value, name)
+	}
+	// resolving does not change the templates other containers resolve against
+	assert.NotNil(t, templates["api-debug"].Field("base"))
+}
+
+// TestProcessTemplates runs the functions with their schema, the short container forms have
+// to pass its validation
+func TestProcessTemplates(t *testing.T) {
+	templates := `
+  - apiVersion: v1
+    kind: LummoContainer
+    metadata:
+      name: foobar
+    spec:
+      image: foobar:1
+      command: ["python", "server.py"]`
+	var tests = []struct {
+		name     string
+		config   framework.ResourceListProcessor
+		input    string
+		expected []string
+		errorMsg string
+	}{
+		{
+			name: "deployment with a bare template name",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:` + templates + `
+functionConfig:
+  apiVersion: v1
+  kind: LummoDeployment
+  metadata:
+    name: foobar
+  spec:
+    part-of: foobar
+    app: foobar
+    containers:
+    - foobar`,
+			expected: []string{"kind: Deployment", "image: foobar:1\n        name: foobar"},
+		},
+		{
+			name: "job with a nameless base",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:` + templates + `
+functionConfig:
+  apiVersion: v1
+  kind: LummoJob
+  metadata:
+    name: daily-foo-job
+  spec:
+    part-of: foobar
+    app: daily-foo-job
+    containers:
+    - base: foobar
+      command: ["python", "batch.py"]
+    - name: whatever
+      image: blah:latest`,
+			expected: []string{"kind: Job", "- batch.py\n        image: foobar:1\n        name: foobar", "name: whatever"},
+		},
+		{
+			name: "misspelled container field",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items: []
+functionConfig:
+  apiVersion: v1
+  kind: LummoDeployment
+  metadata:
+    name: foobar
+  spec:
+    part-of: foobar
+    app: foobar
+    containers:
+    - name: foobar
+      imagee: foobar:1`,
+			errorMsg: "spec.containers[0]: unknown field \"imagee\"",
+		},
+		{
+			name: "schema still applies to the rest of the spec",
+			input: `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:` + templates + `
+functionConfig:
+  apiVersion: v1
+  kind: LummoJob
+  metadata:
+    name: daily-foo-job
+  spec:
+    app: daily-foo-job
+    containers:
+    - foobar`,
+			errorMsg: "part-of in body is required",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := &kio.ByteReader{
+				Reader:                bytes.NewBufferString(test.input),
+				OmitReaderAnnotations: true,
+			}
+			items, err := reader.Read()
+			if !assert.NoError(t, err) {
+				return
+			}
+			rl := &framework.ResourceList{Items: items, FunctionConfig: reader.FunctionConfig}
+			err = processor(reader.FunctionConfig.GetKind()).Process(rl)
+			if test.errorMsg != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.errorMsg)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			out, err := kio.StringAll(rl.Items)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, e := range test.expected {
+				assert.Contains(t, out, e)
+			}
+		})
+	}
+}
+
+// processor is the processor of the function handling kind, like the cmd packages build it
+func processor(kind string) framework.ResourceListProcessor {
+	if kind == "LummoDeployment" {
+		config := FunctionConfig{}
+		return framework.SimpleProcessor{Filter: kio.FilterFunc(config.Filter), Config: &config}
+	}
+	config := JobFunctionConfig{}
+	return framework.SimpleProcessor{Filter: kio.FilterFunc(config.Filter), Config: &config}
+}